@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"mini-zanzibar/internal/config"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+// Exit codes of the fsck subcommand
+const (
+	fsckClean    = 0
+	fsckIssues   = 1
+	fsckFailed   = 2
+	fsckRepaired = 3
+)
+
+// runFsck checks the user indexes of the LevelDB tuple store and, with
+// -repair, fixes it. The server must be stopped, as LevelDB allows a single
+// process to open the database.
+func runFsck(args []string) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return fsckFailed
+	}
+
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	path := flags.String("db", cfg.LevelDBPath, "path of the LevelDB tuple store")
+	repair := flags.Bool("repair", false, "fix the issues found")
+	if err := flags.Parse(args); err != nil {
+		return fsckFailed
+	}
+
+	client, err := leveldb.NewClient(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", *path, err)
+		return fsckFailed
+	}
+	defer client.Close()
+
+	if err := client.WaitForMigration(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate key layout: %v\n", err)
+		return fsckFailed
+	}
+
+	report, err := client.CheckIntegrity(*repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to check integrity: %v\n", err)
+		return fsckFailed
+	}
+
+	for _, issue := range report.Issues {
+		if issue.Tuple != nil {
+			fmt.Printf("%s %s %s#%s@%s %s\n", issue.Kind, issue.Key, issue.Tuple.Object, issue.Tuple.Relation, issue.Tuple.User, issue.Detail)
+		} else {
+			fmt.Printf("%s %s %s\n", issue.Kind, issue.Key, issue.Detail)
+		}
+	}
+	if report.Truncated {
+		fmt.Printf("... %d issues not listed\n", report.TotalIssues()-len(report.Issues))
+	}
+
+	fmt.Printf("checked %d primary, %d reverse and %d relation entries\n", report.PrimaryEntries, report.ReverseEntries, report.RelationEntries)
+	fmt.Printf("dangling reverse: %d, missing reverse: %d, dangling relation: %d, missing relation: %d, malformed: %d\n",
+		report.IssueCounts[leveldb.IssueDanglingReverse],
+		report.IssueCounts[leveldb.IssueMissingReverse],
+		report.IssueCounts[leveldb.IssueDanglingRelation],
+		report.IssueCounts[leveldb.IssueMissingRelation],
+		report.IssueCounts[leveldb.IssueMalformed])
+
+	if report.TotalIssues() == 0 {
+		return fsckClean
+	}
+	if *repair {
+		fmt.Printf("repaired %d entries\n", report.Repaired)
+		return fsckRepaired
+	}
+	return fsckIssues
+}
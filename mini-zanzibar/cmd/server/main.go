@@ -2,15 +2,27 @@ package main
 
 import (
 	"log"
+	"os"
+	"time"
+
 	"mini-zanzibar/internal/api"
 	"mini-zanzibar/internal/config"
+	"mini-zanzibar/internal/database"
 	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/file"
 	"mini-zanzibar/internal/database/leveldb"
+	"mini-zanzibar/internal/database/memory"
 	"mini-zanzibar/internal/database/redis"
 	"mini-zanzibar/internal/utils"
+
+	"go.uber.org/zap"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		os.Exit(runFsck(os.Args[2:]))
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -22,16 +34,25 @@ func main() {
 	defer logger.Sync()
 
 	// Initialize LevelDB for ACL tuples
-	leveldbClient, err := leveldb.NewClient(cfg.LevelDBPath)
+	levelDB, err := leveldb.NewClient(cfg.LevelDBPath)
 	if err != nil {
 		logger.Fatal("Failed to initialize LevelDB", err)
 	}
-	defer leveldbClient.Close()
+	var tupleStore database.TupleStore = levelDB
+	defer tupleStore.Close()
+
+	if levelDB.Migrating() {
+		go reportMigration(levelDB, logger)
+	}
+
+	if cfg.TupleGCInterval > 0 {
+		go collectTupleHistory(tupleStore, cfg.TupleHistoryRetention, cfg.TupleGCInterval, logger)
+	}
 
-	// Initialize Consul for namespace configuration
-	consulClient, err := consul.NewClient(cfg.ConsulAddress, cfg.ConsulDatacenter, cfg.ConsulToken)
+	// Initialize the namespace configuration store
+	namespaceStore, err := newNamespaceStore(cfg)
 	if err != nil {
-		logger.Fatal("Failed to initialize Consul", err)
+		logger.Fatal("Failed to initialize namespace store", err)
 	}
 
 	// Initialize Redis for caching
@@ -43,7 +64,7 @@ func main() {
 	defer redisClient.Close()
 
 	// Initialize API router
-	router := api.NewRouter(leveldbClient, consulClient, redisClient, logger, cfg)
+	router := api.NewRouter(tupleStore, namespaceStore, redisClient, logger, cfg)
 
 	// Start server
 	logger.Info("Starting Mini-Zanzibar server", "host", cfg.ServerHost, "port", cfg.ServerPort)
@@ -51,3 +72,43 @@ func main() {
 		logger.Fatal("Failed to start server", err)
 	}
 }
+
+// newNamespaceStore creates the namespace store selected by NAMESPACE_BACKEND
+func newNamespaceStore(cfg *config.Config) (database.NamespaceStore, error) {
+	switch cfg.NamespaceBackend {
+	case "file":
+		return file.NewClient(cfg.NamespaceDir)
+	case "memory":
+		return memory.NewNamespaceStore(), nil
+	default:
+		return consul.NewClient(cfg.ConsulAddress, cfg.ConsulDatacenter, cfg.ConsulToken)
+	}
+}
+
+// reportMigration logs the end of the background key layout migration
+func reportMigration(client *leveldb.Client, logger *zap.SugaredLogger) {
+	logger.Infow("Migrating LevelDB key layout in the background")
+	if err := client.WaitForMigration(); err != nil {
+		logger.Errorw("failed to migrate LevelDB key layout", "error", err)
+		return
+	}
+	if !client.Migrating() {
+		logger.Infow("Migrated LevelDB key layout")
+	}
+}
+
+// collectTupleHistory garbage collects the tuple versions older than
+// retention every interval
+func collectTupleHistory(tupleStore database.TupleStore, retention, interval time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed, err := tupleStore.GarbageCollect(retention)
+		if err != nil {
+			logger.Errorw("failed to garbage collect tuple history", "error", err)
+			continue
+		}
+		logger.Infow("Garbage collected tuple history", "removed", removed, "retention", retention.String())
+	}
+}
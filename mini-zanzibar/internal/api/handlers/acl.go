@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"mini-zanzibar/internal/database"
 	"mini-zanzibar/internal/database/consul"
 	"mini-zanzibar/internal/database/leveldb"
 	"mini-zanzibar/internal/database/redis"
+	"mini-zanzibar/internal/engine"
 	"mini-zanzibar/internal/models"
+	"mini-zanzibar/pkg/zookie"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,19 +22,35 @@ import (
 )
 
 type ACLHandler struct {
-	leveldbClient *leveldb.Client
-	consulClient  *consul.Client
-	redisClient   *redis.Client
-	logger        *zap.SugaredLogger
+	tupleStore     database.TupleStore
+	namespaceStore database.NamespaceStore
+	redisClient    *redis.Client
+	checker        *engine.Checker
+	admins         adminAccess
+	maxBatchItems  int
+	logger         *zap.SugaredLogger
 }
 
+const (
+	// batchCheckConcurrency bounds how many items of a batch check are
+	// evaluated at the same time
+	batchCheckConcurrency = 8
+	// maxContextualTuples bounds the contextual tuples of a single request
+	maxContextualTuples = 100
+	// maxWriteUpdates bounds the updates and the preconditions of a single write
+	maxWriteUpdates = 100
+)
+
 // NewACLHandler creates a new ACL handler
-func NewACLHandler(leveldbClient *leveldb.Client, consulClient *consul.Client, redisClient *redis.Client, logger *zap.SugaredLogger) *ACLHandler {
+func NewACLHandler(tupleStore database.TupleStore, namespaceStore database.NamespaceStore, redisClient *redis.Client, checker *engine.Checker, adminUser string, maxBatchItems int, logger *zap.SugaredLogger) *ACLHandler {
 	return &ACLHandler{
-		leveldbClient: leveldbClient,
-		consulClient:  consulClient,
-		redisClient:   redisClient,
-		logger:        logger,
+		tupleStore:     tupleStore,
+		namespaceStore: namespaceStore,
+		redisClient:    redisClient,
+		checker:        checker,
+		admins:         adminAccess{user: adminUser, checker: checker, logger: logger},
+		maxBatchItems:  maxBatchItems,
+		logger:         logger,
 	}
 }
 
@@ -64,7 +86,7 @@ func (h *ACLHandler) CreateACL(c *gin.Context) {
 		// Also auto-create the doc namespace if it doesn't exist
 		user, exists := c.Get("user")
 		if exists && user.(string) == "user:alice" {
-			existingTuples, checkErr := h.leveldbClient.ListTuplesByUser("user:alice")
+			existingTuples, checkErr := h.tupleStore.ListTuplesByUser("user:alice")
 			if checkErr == nil && len(existingTuples) == 0 {
 				h.logger.Infow("Bootstrap mode: Bypassing validation for alice's first ACL", "object", req.Object, "relation", req.Relation)
 
@@ -120,7 +142,7 @@ func (h *ACLHandler) CreateACL(c *gin.Context) {
 		User:     req.User,
 	}
 
-	if err := h.leveldbClient.StoreTuple(tuple); err != nil {
+	if err := h.tupleStore.StoreTuple(tuple); err != nil {
 		h.logger.Errorw("Failed to store ACL tuple", "error", err, "tuple", tuple)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store ACL"})
 		return
@@ -132,11 +154,126 @@ func (h *ACLHandler) CreateACL(c *gin.Context) {
 		// Don't fail the main operation if auto-grant fails
 	}
 
-	// Invalidate cache for this object and user
-	h.invalidateAuthorizationCache(req.Object, req.Relation, req.User)
+	revision, err := h.tupleStore.Revision()
+	if err != nil {
+		h.logger.Errorw("Failed to read revision", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read revision"})
+		return
+	}
+
+	h.logger.Infow("ACL tuple created", "tuple", tuple, "revision", revision)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "ACL created successfully",
+		"zookie":  zookie.Encode(revision),
+	})
+}
+
+// WriteACL handles POST /acl/write - Apply several tuple updates atomically.
+// Either every update is applied as a single revision or, if a
+// precondition fails, none is.
+func (h *ACLHandler) WriteACL(c *gin.Context) {
+	var req models.WriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, preconditions, err := h.validateWriteRequest(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	authorized := make(map[string]bool)
+	for _, change := range changes {
+		if authorized[change.Tuple.Object] {
+			continue
+		}
+		if !h.isAuthorizedForACLManagement(c, change.Tuple.Object) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Unauthorized to manage ACLs for %s", change.Tuple.Object)})
+			return
+		}
+		authorized[change.Tuple.Object] = true
+	}
+
+	err = h.tupleStore.Write(changes, preconditions)
+	if errors.Is(err, leveldb.ErrPreconditionFailed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, leveldb.ErrDuplicateChange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("Failed to write ACL tuples", "error", err, "request", req)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write ACLs"})
+		return
+	}
+
+	revision, err := h.tupleStore.Revision()
+	if err != nil {
+		h.logger.Errorw("Failed to read revision", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read revision"})
+		return
+	}
+
+	h.logger.Infow("ACL tuples written", "updates", len(changes), "preconditions", len(preconditions), "revision", revision)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ACLs written successfully",
+		"zookie":  zookie.Encode(revision),
+	})
+}
+
+// validateWriteRequest validates the updates and preconditions of a write
+// and converts them for the tuple store. A tuple may only be updated once
+// per write, and stored tuples must use a configured relation.
+func (h *ACLHandler) validateWriteRequest(req models.WriteRequest) ([]leveldb.Change, []leveldb.Precondition, error) {
+	if len(req.Updates) == 0 {
+		return nil, nil, fmt.Errorf("updates must not be empty")
+	}
+	if len(req.Updates) > maxWriteUpdates || len(req.Preconditions) > maxWriteUpdates {
+		return nil, nil, fmt.Errorf("at most %d updates and %d preconditions are allowed per write", maxWriteUpdates, maxWriteUpdates)
+	}
+
+	changes := make([]leveldb.Change, len(req.Updates))
+	updated := make(map[leveldb.ACLTuple]bool)
+	for i, update := range req.Updates {
+		switch update.Operation {
+		case leveldb.OperationTouch, leveldb.OperationCreate:
+			if err := h.validateNamespaceAndRelation(update.Tuple.Object, update.Tuple.Relation); err != nil {
+				return nil, nil, fmt.Errorf("update %d: %v", i, err)
+			}
+		case leveldb.OperationDelete:
+		default:
+			return nil, nil, fmt.Errorf("update %d: operation must be touch, create or delete", i)
+		}
+		if err := h.validateACLRequest(models.ACLRequest(update.Tuple)); err != nil {
+			return nil, nil, fmt.Errorf("update %d: %v", i, err)
+		}
+
+		tuple := leveldb.ACLTuple(update.Tuple)
+		if updated[tuple] {
+			return nil, nil, fmt.Errorf("update %d: tuple is updated more than once", i)
+		}
+		updated[tuple] = true
+		changes[i] = leveldb.Change{Operation: update.Operation, Tuple: tuple}
+	}
+
+	preconditions := make([]leveldb.Precondition, len(req.Preconditions))
+	for i, precondition := range req.Preconditions {
+		switch precondition.Condition {
+		case leveldb.ConditionMustExist, leveldb.ConditionMustNotExist:
+		default:
+			return nil, nil, fmt.Errorf("precondition %d: condition must be must_exist or must_not_exist", i)
+		}
+		if err := h.validateACLRequest(models.ACLRequest(precondition.Tuple)); err != nil {
+			return nil, nil, fmt.Errorf("precondition %d: %v", i, err)
+		}
+		preconditions[i] = leveldb.Precondition{Condition: precondition.Condition, Tuple: leveldb.ACLTuple(precondition.Tuple)}
+	}
 
-	h.logger.Infow("ACL tuple created", "tuple", tuple)
-	c.JSON(http.StatusCreated, gin.H{"message": "ACL created successfully"})
+	return changes, preconditions, nil
 }
 
 // CheckACL handles GET /acl/check - Check authorization
@@ -153,42 +290,515 @@ func (h *ACLHandler) CheckACL(c *gin.Context) {
 		return
 	}
 
-	// Caching for performance
-	cacheKey := fmt.Sprintf("auth:%s:%s:%s", req.Object, req.Relation, req.User)
+	if !h.checkFreshness(c) {
+		return
+	}
+
+	var opts engine.CheckOptions
+	if !h.atRevision(c, &opts) {
+		return
+	}
 
-	// Try to get from cache first
-	if cached, found := h.redisClient.Get(cacheKey); found {
-		authorized, ok := cached.(bool)
-		if ok {
-			response := models.ACLCheckResponse{
-				Authorized: authorized,
-			}
-			h.logger.Debugw("authorization cache hit", "request", req, "authorized", authorized)
-			c.JSON(http.StatusOK, response)
+	if explain, _ := strconv.ParseBool(c.Query("explain")); explain {
+		h.explainCheck(c, req, opts)
+		return
+	}
+
+	authorized, cached, err := h.cachedCheck(c.Request.Context(), req.Object, req.Relation, req.User, opts)
+	if errors.Is(err, engine.ErrMaxDepthExceeded) {
+		h.logger.Warnw("authorization check exceeded max depth", "request", req)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "max depth exceeded"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("failed to check authorization", "error", err, "request", req)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check authorization"})
+		return
+	}
+
+	response := models.ACLCheckResponse{
+		Authorized: authorized,
+	}
+
+	h.logger.Infow("Authorization check", "request", req, "authorized", authorized, "cache_miss", !cached)
+	c.JSON(http.StatusOK, response)
+}
+
+// CheckACLWithContext handles POST /acl/check - Check authorization with
+// optional contextual tuples, which are never written or cached
+func (h *ACLHandler) CheckACLWithContext(c *gin.Context) {
+	var req models.ContextualCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts, err := h.contextualOptions(req.ContextualTuples)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkFreshness(c) || !h.atRevision(c, &opts) {
+		return
+	}
+
+	authorized, cached, err := h.cachedCheck(c.Request.Context(), req.Object, req.Relation, req.User, opts)
+	if errors.Is(err, engine.ErrMaxDepthExceeded) {
+		h.logger.Warnw("authorization check exceeded max depth", "request", req)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "max depth exceeded"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("failed to check authorization", "error", err, "request", req)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check authorization"})
+		return
+	}
+
+	h.logger.Infow("Authorization check", "request", req, "authorized", authorized, "cache_miss", !cached)
+	c.JSON(http.StatusOK, models.ACLCheckResponse{Authorized: authorized})
+}
+
+// contextualOptions validates contextual tuples and returns the check
+// options evaluating them
+func (h *ACLHandler) contextualOptions(tuples []models.ACLTuple) (engine.CheckOptions, error) {
+	if len(tuples) > maxContextualTuples {
+		return engine.CheckOptions{}, fmt.Errorf("at most %d contextual tuples are allowed", maxContextualTuples)
+	}
+
+	var opts engine.CheckOptions
+	for i, tuple := range tuples {
+		if err := h.validateACLRequest(models.ACLRequest(tuple)); err != nil {
+			return engine.CheckOptions{}, fmt.Errorf("contextual tuple %d: %v", i, err)
+		}
+		opts.ContextualTuples = append(opts.ContextualTuples, leveldb.ACLTuple(tuple))
+	}
+	return opts, nil
+}
+
+// explainCheck answers a check with explain=true. The check is always
+// evaluated so the trace is complete; the trace root records whether the
+// result came from the cache, and a cached result is still what is returned.
+// Checks at a snapshot never use the cache and return the evaluation only.
+func (h *ACLHandler) explainCheck(c *gin.Context, req models.ACLCheckRequest, opts engine.CheckOptions) {
+	if opts.Tuples != nil {
+		authorized, trace, err := h.checker.Explain(c.Request.Context(), req.Object, req.Relation, req.User, opts)
+		if errors.Is(err, engine.ErrMaxDepthExceeded) {
+			h.logger.Warnw("authorization check exceeded max depth", "request", req)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "max depth exceeded", "trace": trace})
+			return
+		}
+		if err != nil {
+			h.logger.Errorw("failed to check authorization", "error", err, "request", req)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check authorization"})
 			return
 		}
+
+		h.logger.Infow("Explained authorization check", "request", req, "authorized", authorized, "at_revision", c.Query("at_revision"))
+		c.JSON(http.StatusOK, gin.H{
+			"authorized": authorized,
+			"trace":      trace,
+		})
+		return
+	}
+
+	revision, err := h.tupleStore.Revision()
+	if err != nil {
+		h.logger.Errorw("failed to read revision", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check authorization"})
+		return
 	}
 
-	// Implement full authorization logic with namespace rules
-	// Handle computed usersets and union operations
-	authorized, err := h.performAuthorizationCheck(req.Object, req.Relation, req.User)
+	cacheKey := authCacheKey(req.Object, req.Relation, req.User)
+	cached, hit := h.getCachedResult(cacheKey)
+	stale := hit && cached.Revision < revision
+
+	authorized, trace, err := h.checker.Explain(c.Request.Context(), req.Object, req.Relation, req.User, engine.CheckOptions{})
+	if errors.Is(err, engine.ErrMaxDepthExceeded) {
+		h.logger.Warnw("authorization check exceeded max depth", "request", req)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "max depth exceeded", "trace": trace})
+		return
+	}
 	if err != nil {
 		h.logger.Errorw("failed to check authorization", "error", err, "request", req)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check authorization"})
 		return
 	}
 
-	// Cache the result with 5-minute expiration
-	h.redisClient.Set(cacheKey, authorized, 5*time.Minute)
+	root := &engine.TraceNode{
+		Type:     engine.TraceCache,
+		Result:   authorized,
+		Reason:   "cache miss",
+		Children: []*engine.TraceNode{trace},
+	}
+	switch {
+	case stale:
+		root.Reason = "cache entry older than the current revision, evaluated instead"
+		h.setCachedResult(cacheKey, authorized, revision)
+	case hit && cached.Authorized == authorized:
+		root.Reason = "cache hit"
+	case hit:
+		root.Result = cached.Authorized
+		root.Reason = "cache hit: the cached result differs from the evaluation below, which raced with a write, and is returned until the next write"
+	default:
+		h.setCachedResult(cacheKey, authorized, revision)
+	}
 
-	response := models.ACLCheckResponse{
-		Authorized: authorized,
+	h.logger.Infow("Explained authorization check", "request", req, "authorized", root.Result, "cache_hit", hit)
+	c.JSON(http.StatusOK, gin.H{
+		"authorized": root.Result,
+		"trace":      root,
+	})
+}
+
+// BatchCheckACL handles POST /acl/check/batch - Check several authorizations
+// at once. Items are evaluated concurrently and share intermediate results;
+// each item gets its own result or error, in request order.
+func (h *ACLHandler) BatchCheckACL(c *gin.Context) {
+	var req models.BatchCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "items must not be empty"})
+		return
+	}
+	if len(req.Items) > h.maxBatchItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d items are allowed per batch", h.maxBatchItems)})
+		return
+	}
+
+	opts, err := h.contextualOptions(req.ContextualTuples)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts.Memo = engine.NewMemo()
+
+	if !h.checkFreshness(c) || !h.atRevision(c, &opts) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := make([]models.BatchCheckResult, len(req.Items))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchCheckConcurrency)
+	for i, item := range req.Items {
+		wg.Add(1)
+		go func(i int, item models.ACLCheckRequest) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = h.checkBatchItem(ctx, item, opts)
+		}(i, item)
+	}
+	wg.Wait()
+
+	h.logger.Infow("Batch authorization check", "items", len(req.Items))
+	c.JSON(http.StatusOK, models.BatchCheckResponse{Results: results})
+}
+
+// checkBatchItem evaluates a single item of a batch check
+func (h *ACLHandler) checkBatchItem(ctx context.Context, item models.ACLCheckRequest, opts engine.CheckOptions) models.BatchCheckResult {
+	if item.Object == "" || item.Relation == "" || item.User == "" {
+		return models.BatchCheckResult{Error: "object, relation and user are required"}
+	}
+
+	authorized, _, err := h.cachedCheck(ctx, item.Object, item.Relation, item.User, opts)
+	if errors.Is(err, engine.ErrMaxDepthExceeded) {
+		h.logger.Warnw("authorization check exceeded max depth", "request", item)
+		return models.BatchCheckResult{Error: "max depth exceeded"}
+	}
+	if err != nil {
+		h.logger.Errorw("failed to check authorization", "error", err, "request", item)
+		return models.BatchCheckResult{Error: "failed to check authorization"}
+	}
+
+	return models.BatchCheckResult{Authorized: authorized}
+}
+
+// cachedCheck evaluates object#relation@user, answering from the
+// authorization cache when possible and caching fresh results for 5 minutes.
+// A check may read tuples of any object, e.g. through group membership, so no
+// write can tell which entries it invalidates. Entries are therefore only
+// used at the revision they were evaluated at, and every write turns all of
+// them into misses. cached reports whether the result came from the cache.
+// Checks with contextual tuples or at a snapshot bypass the cache entirely.
+func (h *ACLHandler) cachedCheck(ctx context.Context, object, relation, user string, opts engine.CheckOptions) (authorized, cached bool, err error) {
+	if len(opts.ContextualTuples) > 0 || opts.Tuples != nil {
+		authorized, err = h.checker.CheckWithOptions(ctx, object, relation, user, opts)
+		return authorized, false, err
+	}
+
+	// The evaluation below sees at least this revision
+	revision, err := h.tupleStore.Revision()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to read revision: %v", err)
+	}
+
+	cacheKey := authCacheKey(object, relation, user)
+
+	if entry, found := h.getCachedResult(cacheKey); found && entry.Revision >= revision {
+		h.logger.Debugw("authorization cache hit", "object", object, "relation", relation, "user", user, "authorized", entry.Authorized)
+		return entry.Authorized, true, nil
+	}
+
+	authorized, err = h.checker.CheckWithOptions(ctx, object, relation, user, opts)
+	if err != nil {
+		return false, false, err
+	}
+
+	h.setCachedResult(cacheKey, authorized, revision)
+	return authorized, false, nil
+}
+
+// cachedResult is an authorization result in the cache, with the revision
+// the evaluation was at least as fresh as
+type cachedResult struct {
+	Authorized bool   `json:"authorized"`
+	Revision   uint64 `json:"revision"`
+}
+
+// getCachedResult returns the authorization result cached under cacheKey.
+// Entries cached as a bare bool predate revisions and count as revision 0.
+func (h *ACLHandler) getCachedResult(cacheKey string) (cachedResult, bool) {
+	value, found := h.redisClient.Get(cacheKey)
+	if !found {
+		return cachedResult{}, false
+	}
+
+	switch value := value.(type) {
+	case bool:
+		return cachedResult{Authorized: value}, true
+	case map[string]interface{}:
+		authorized, ok := value["authorized"].(bool)
+		revision, _ := value["revision"].(float64)
+		return cachedResult{Authorized: authorized, Revision: uint64(revision)}, ok
+	default:
+		return cachedResult{}, false
+	}
+}
+
+// setCachedResult caches an authorization result for 5 minutes
+func (h *ACLHandler) setCachedResult(cacheKey string, authorized bool, revision uint64) {
+	h.redisClient.Set(cacheKey, cachedResult{Authorized: authorized, Revision: revision}, 5*time.Minute)
+}
+
+// checkFreshness validates the request's at_least_as_fresh token, if any. It
+// writes an error response and returns false if the token is invalid or newer
+// than the store. Validation is all the token needs, since the store is always
+// at its latest revision and cached results are only used at the latest
+// revision.
+func (h *ACLHandler) checkFreshness(c *gin.Context) bool {
+	token := c.Query("at_least_as_fresh")
+	if token == "" {
+		return true
+	}
+
+	minRevision, err := zookie.Decode(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	revision, err := h.tupleStore.Revision()
+	if err != nil {
+		h.logger.Errorw("failed to read revision", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read revision"})
+		return false
+	}
+	if revision < minRevision {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at_least_as_fresh is newer than the current revision"})
+		return false
+	}
+
+	return true
+}
+
+// atRevision points opts at the snapshot of the request's at_revision token,
+// if there is one, so the check is evaluated exactly as it would have been at
+// that revision. It writes an error response and returns false if the token
+// is invalid or its revision is not available.
+func (h *ACLHandler) atRevision(c *gin.Context, opts *engine.CheckOptions) bool {
+	token := c.Query("at_revision")
+	if token == "" {
+		return true
+	}
+
+	revision, err := zookie.Decode(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	snapshot, err := h.tupleStore.Snapshot(revision)
+	switch {
+	case errors.Is(err, leveldb.ErrSnapshotExpired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at_revision is older than the retained tuple history"})
+		return false
+	case errors.Is(err, leveldb.ErrFutureRevision):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at_revision is newer than the current revision"})
+		return false
+	case err != nil:
+		h.logger.Errorw("failed to open snapshot", "error", err, "revision", revision)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read revision"})
+		return false
+	}
+
+	opts.Tuples = snapshot
+	return true
+}
+
+// authCacheKey returns the cache key of an authorization result
+func authCacheKey(object, relation, user string) string {
+	return fmt.Sprintf("auth:%s:%s:%s", object, relation, user)
+}
+
+// ExpandACL handles GET /acl/expand - Return the userset tree of object#relation
+func (h *ACLHandler) ExpandACL(c *gin.Context) {
+	var req models.ACLExpandRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(strings.Split(req.Object, ":")) != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "object must be in format 'namespace:object_id'"})
+		return
+	}
+
+	if req.Depth < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "depth must not be negative"})
+		return
+	}
+
+	if !h.checkFreshness(c) {
+		return
+	}
+
+	// The tree lists every subject of the object, so it is guarded like ACL listing
+	if !h.isAuthorizedForACLListing(c, req.Object) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized to expand ACLs for this object"})
+		return
+	}
+
+	tree, err := h.checker.Expand(c.Request.Context(), req.Object, req.Relation, req.Depth)
+	if err != nil {
+		h.logger.Errorw("failed to expand userset", "error", err, "request", req)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to expand userset"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object":   req.Object,
+		"relation": req.Relation,
+		"tree":     tree,
+	})
+}
+
+// LookupResources handles GET /acl/lookup-resources - List the objects of a
+// namespace a user has a relation to
+func (h *ACLHandler) LookupResources(c *gin.Context) {
+	var req models.LookupResourcesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkFreshness(c) {
+		return
+	}
+
+	if !h.isAuthorizedForACLListing(c, req.User) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized to look up resources for this user"})
+		return
+	}
+
+	after, err := leveldb.DecodeCursor(req.Cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+	if pageSize > 1000 {
+		pageSize = 1000
+	}
+
+	ids, more, err := h.checker.LookupResources(c.Request.Context(), req.Namespace, req.Relation, req.User, string(after), pageSize)
+	if errors.Is(err, engine.ErrMaxDepthExceeded) {
+		h.logger.Warnw("resource lookup exceeded max depth", "request", req)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "max depth exceeded"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("failed to look up resources", "error", err, "request", req)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up resources"})
+		return
+	}
+
+	response := models.LookupResourcesResponse{
+		ObjectIDs: ids,
+	}
+	if response.ObjectIDs == nil {
+		response.ObjectIDs = []string{}
+	}
+	if more {
+		response.NextCursor = leveldb.EncodeCursor([]byte(ids[len(ids)-1]))
 	}
 
-	h.logger.Infow("Authorization check", "request", req, "authorized", authorized, "cache_miss", true)
 	c.JSON(http.StatusOK, response)
 }
 
+// LookupSubjects handles GET /acl/lookup-subjects - List the subjects that
+// effectively have a relation to an object
+func (h *ACLHandler) LookupSubjects(c *gin.Context) {
+	var req models.LookupSubjectsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(strings.Split(req.Object, ":")) != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "object must be in format 'namespace:object_id'"})
+		return
+	}
+
+	if !h.checkFreshness(c) {
+		return
+	}
+
+	if !h.isAuthorizedForACLListing(c, req.Object) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized to look up subjects for this object"})
+		return
+	}
+
+	subjects, err := h.checker.LookupSubjects(c.Request.Context(), req.Object, req.Relation)
+	if errors.Is(err, engine.ErrMaxDepthExceeded) {
+		h.logger.Warnw("subject lookup exceeded max depth", "request", req)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "max depth exceeded"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("failed to look up subjects", "error", err, "request", req)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up subjects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object":   req.Object,
+		"relation": req.Relation,
+		"subjects": subjects,
+	})
+}
+
 // DeleteACL handles DELETE /acl - Delete an ACL tuple
 func (h *ACLHandler) DeleteACL(c *gin.Context) {
 	var req models.ACLRequest
@@ -199,6 +809,7 @@ func (h *ACLHandler) DeleteACL(c *gin.Context) {
 
 	if err := h.validateACLRequest(req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	// Implement authorization check for ACL management
@@ -207,17 +818,24 @@ func (h *ACLHandler) DeleteACL(c *gin.Context) {
 		return
 	}
 
-	if err := h.leveldbClient.DeleteTuple(req.Object, req.Relation, req.User); err != nil {
+	if err := h.tupleStore.DeleteTuple(req.Object, req.Relation, req.User); err != nil {
 		h.logger.Errorw("Failed to delete ACL tuple", "error", err, "request", req)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ACL"})
 		return
 	}
 
-	// Invalidate cache for this object and user
-	h.invalidateAuthorizationCache(req.Object, req.Relation, req.User)
+	revision, err := h.tupleStore.Revision()
+	if err != nil {
+		h.logger.Errorw("Failed to read revision", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read revision"})
+		return
+	}
 
-	h.logger.Infow("ACL tuple deleted", "request", req)
-	c.JSON(http.StatusOK, gin.H{"message": "ACL deleted successfully"})
+	h.logger.Infow("ACL tuple deleted", "request", req, "revision", revision)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ACL deleted successfully",
+		"zookie":  zookie.Encode(revision),
+	})
 }
 
 // ListACLsByObject handles GET /acl/object/:object - List ACLs for an object
@@ -228,33 +846,28 @@ func (h *ACLHandler) ListACLsByObject(c *gin.Context) {
 		return
 	}
 
+	if !h.checkFreshness(c) {
+		return
+	}
+
 	// Authorization check for ACL listing
 	if !h.isAuthorizedForACLListing(c, object) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized to list ACLs for this object"})
 		return
 	}
-	// Add pagination for large result sets
-	page, pageSize := h.getPaginationParams(c)
-
-	// Use paginated version
-	tuples, total, err := h.leveldbClient.ListTuplesByObjectPagination(object, page, pageSize)
+	// Cursor pagination for large result sets
+	tuples, next, err := h.tupleStore.ListTuplesByObjectPagination(object, c.Query("cursor"), h.getPageSize(c))
+	if errors.Is(err, leveldb.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
 	if err != nil {
 		h.logger.Errorw("failed to list ACLs by object", "error", err, "object", object)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list ACLs"})
 		return
 	}
 
-	response := gin.H{
-		"tuples": tuples,
-		"pagination": gin.H{
-			"page":      page,
-			"page_size": pageSize,
-			"total":     total,
-			"has_more":  len(tuples) == pageSize,
-		},
-	}
-
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, tuplePage(tuples, next))
 }
 
 // ListACLsByUser handles GET /acl/user/:user - List ACLs for a user
@@ -265,34 +878,41 @@ func (h *ACLHandler) ListACLsByUser(c *gin.Context) {
 		return
 	}
 
+	if !h.checkFreshness(c) {
+		return
+	}
+
 	// Authorization check for ACL listing
 	if !h.isAuthorizedForACLListing(c, user) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized to list ACLs for this user"})
 		return
 	}
-	// Pagination for large result sets
-	page, pageSize := h.getPaginationParams(c)
-
-	// Use paginated version
-	tuples, total, err := h.leveldbClient.ListTuplesByUserPagination(user, page, pageSize)
-
+	// Cursor pagination for large result sets
+	tuples, next, err := h.tupleStore.ListTuplesByUserPagination(user, c.Query("cursor"), h.getPageSize(c))
+	if errors.Is(err, leveldb.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
 	if err != nil {
 		h.logger.Errorw("failed to list ACLs by user", "error", err, "user", user)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list ACLs"})
 		return
 	}
 
-	response := gin.H{
-		"tuples": tuples,
-		"pagination": gin.H{
-			"page":      page,
-			"page_size": pageSize,
-			"total":     total,
-			"has_more":  len(tuples) == pageSize,
-		},
-	}
+	c.JSON(http.StatusOK, tuplePage(tuples, next))
+}
 
-	c.JSON(http.StatusOK, response)
+// tuplePage formats a page of a tuple listing; next_cursor is omitted on the
+// last page
+func tuplePage(tuples []leveldb.ACLTuple, next string) gin.H {
+	if tuples == nil {
+		tuples = []leveldb.ACLTuple{}
+	}
+	response := gin.H{"tuples": tuples}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+	return response
 }
 
 func (h *ACLHandler) validateACLRequest(req models.ACLRequest) error {
@@ -313,9 +933,17 @@ func (h *ACLHandler) validateACLRequest(req models.ACLRequest) error {
 		return fmt.Errorf("object must be in format 'namespace:object_id'")
 	}
 
+	// The user is either a plain subject or a userset such as group:eng#member
+	if strings.Contains(req.User, "#") {
+		if _, _, ok := engine.ParseUserset(req.User); !ok {
+			return fmt.Errorf("userset user must be in format 'namespace:object_id#relation'")
+		}
+		return nil
+	}
+
 	userParts := strings.Split(req.User, ":")
 	if len(userParts) < 2 {
-		return fmt.Errorf("user must be in format 'user_type:user_id' or 'userset:namespace:relation'")
+		return fmt.Errorf("user must be in format 'user_type:user_id' or 'namespace:object_id#relation'")
 	}
 
 	return nil
@@ -329,7 +957,7 @@ func (h *ACLHandler) validateNamespaceAndRelation(object string, relation string
 	namespace := parts[0]
 
 	// Check if namespace exists in Consul
-	exists, err := h.consulClient.NamespaceExists(namespace)
+	exists, err := h.namespaceStore.NamespaceExists(namespace)
 	if err != nil {
 		return fmt.Errorf("failed to check namespace: %v", err)
 	}
@@ -339,7 +967,7 @@ func (h *ACLHandler) validateNamespaceAndRelation(object string, relation string
 	}
 
 	// Check if relation is valid for this namespace
-	valid, err := h.consulClient.RelationExists(namespace, relation)
+	valid, err := h.namespaceStore.RelationExists(namespace, relation)
 	if err != nil {
 		return fmt.Errorf("failed to check relation: %v", err)
 	}
@@ -379,10 +1007,16 @@ func (h *ACLHandler) isAuthorizedForACLManagement(c *gin.Context, object string)
 	userStr := user.(string)
 	h.logger.Infow("DEBUG: Checking authorization for user", "user", userStr, "object", object)
 
+	// Admin grants are managed by admins only, so none of the rules for
+	// ordinary objects below can make a user an admin
+	if object == adminObject {
+		return h.admins.allows(c.Request.Context(), userStr)
+	}
+
 	// Bootstrap mode: If no ACLs exist in the system, allow alice to be the first owner
 	if userStr == "user:alice" {
 		// Check if any ACLs exist in the system by checking if alice has any existing ACLs
-		existingTuples, err := h.leveldbClient.ListTuplesByUser("user:alice")
+		existingTuples, err := h.tupleStore.ListTuplesByUser("user:alice")
 		if err != nil {
 			h.logger.Errorw("Failed to check existing ACLs for bootstrap", "error", err)
 			// Continue with normal authorization check
@@ -394,7 +1028,7 @@ func (h *ACLHandler) isAuthorizedForACLManagement(c *gin.Context, object string)
 			} else {
 				// SPECIAL CASE: Allow Alice to create new documents even if she has existing ACLs
 				// Check if this is a NEW document that Alice doesn't own yet
-				authorized, err := h.performAuthorizationCheck(object, "owner", userStr)
+				authorized, err := h.checker.Check(c.Request.Context(), object, "owner", userStr)
 				if err != nil {
 					h.logger.Errorw("Failed to check if Alice owns this specific object", "error", err)
 				} else if !authorized {
@@ -408,7 +1042,7 @@ func (h *ACLHandler) isAuthorizedForACLManagement(c *gin.Context, object string)
 
 	// PRIMARY CHECK: Check if user is owner of the specific object
 	// In Zanzibar model, only owners can manage ACLs for their objects
-	authorized, err := h.performAuthorizationCheck(object, "owner", userStr)
+	authorized, err := h.checker.Check(c.Request.Context(), object, "owner", userStr)
 	if err != nil {
 		h.logger.Errorw("Failed to check owner authorization", "error", err, "object", object, "user", userStr)
 	} else if authorized {
@@ -418,7 +1052,7 @@ func (h *ACLHandler) isAuthorizedForACLManagement(c *gin.Context, object string)
 
 	// SPECIAL CASE: Allow creating owner permissions for new documents
 	// If the object doesn't have ANY ACLs yet, allow the requesting user to become the owner
-	existingObjectTuples, err := h.leveldbClient.ListTuplesByObject(object)
+	existingObjectTuples, err := h.tupleStore.ListTuplesByObject(object)
 	if err != nil {
 		h.logger.Errorw("Failed to check existing ACLs for object", "error", err, "object", object)
 	} else if len(existingObjectTuples) == 0 {
@@ -427,7 +1061,7 @@ func (h *ACLHandler) isAuthorizedForACLManagement(c *gin.Context, object string)
 	}
 
 	// SECONDARY CHECK: Check if user has any owner privileges (for Alice's special case and other scenarios)
-	existingTuples, err := h.leveldbClient.ListTuplesByUser(userStr)
+	existingTuples, err := h.tupleStore.ListTuplesByUser(userStr)
 	if err != nil {
 		h.logger.Errorw("Failed to check user's existing ACLs", "error", err, "user", userStr)
 	} else {
@@ -455,146 +1089,6 @@ func (h *ACLHandler) isAuthorizedForACLManagement(c *gin.Context, object string)
 	return false
 }
 
-// Full authorization logic with namespace rules
-// Handle computed usersets and union operations
-func (h *ACLHandler) performAuthorizationCheck(object, relation, user string) (bool, error) {
-	// 1. Check direct tuple first (common case)
-	directAuthorized, err := h.leveldbClient.CheckTuple(object, relation, user)
-
-	if err != nil {
-		return false, fmt.Errorf("failed to check direct tuple: %v", err)
-	}
-
-	if directAuthorized {
-		return true, nil
-	}
-
-	// 2. Check permission hierarchy: owner > editor > viewer
-	// If user is checking for viewer/editor permission, also check if they have higher permissions
-	hierarchyPermissions := h.getPermissionHierarchy(relation)
-	for _, higherPermission := range hierarchyPermissions {
-		if higherPermission != relation {
-			higherAuthorized, err := h.leveldbClient.CheckTuple(object, higherPermission, user)
-			if err != nil {
-				h.logger.Warnw("Failed to check higher permission", "error", err, "permission", higherPermission)
-				continue
-			}
-			if higherAuthorized {
-				h.logger.Infow("User authorized via permission hierarchy",
-					"user", user, "object", object, "requested", relation, "granted_via", higherPermission)
-				return true, nil
-			}
-		}
-	}
-
-	// 3. Check namespace rules for computed usersets and union operations
-	parts := strings.Split(object, ":")
-	if len(parts) != 2 {
-		return false, nil
-	}
-	namespace := parts[0]
-
-	// Get namespace configuration to check for computed usersets
-	config, err := h.consulClient.GetNamespace(namespace)
-	if err != nil {
-		return false, fmt.Errorf("failed to get namespace config: %v", err)
-	}
-
-	// Check if this relation has computed usersets defined
-	if relationConfig, exists := config.Relations[relation]; exists {
-		for _, union := range relationConfig.Union {
-			// Handle computed userset
-			if union.ComputedUserset != nil {
-				computedRelation := union.ComputedUserset.Relation
-
-				authorized, err := h.checkComputedUserset(object, computedRelation, user)
-
-				if err != nil {
-					return false, err
-				}
-
-				if authorized {
-					return true, nil
-				}
-			}
-
-			// Handle union of multiple relations (this is a simplified version)
-			// In a full implementation, you'd handle union, intersection, and exclusion
-			if union.This != nil {
-				// This represents direct membership - already checked above
-				continue
-			}
-		}
-	}
-
-	return false, nil
-}
-
-// checkComputedUserset handles computed userset logic
-func (h *ACLHandler) checkComputedUserset(object, computedRelation, user string) (bool, error) {
-	// For computed userset, we need to find all objects that this object has the computed relation to
-	// and check if the user has the base relation to those objects
-
-	// This is a simplified implementation - in a real Zanzibar-like system,
-	// you'd have a more complex graph traversal
-
-	// Example: If document:1 has editor → group:eng and user is member of group:eng
-	// Then user is effectively an editor of document:1
-
-	// Get all tuples where this object has the computed relation
-	relatedTuples, err := h.leveldbClient.ListTuplesByObjectAndRelation(object, computedRelation)
-	if err != nil {
-		return false, err
-	}
-
-	// Check if user has the base relation to any of the related objects
-	for _, tuple := range relatedTuples {
-		// tuple.User is the target object in the computed relation
-		// Check if our user has the base relation to that target object
-		authorized, err := h.performAuthorizationCheck(tuple.User, computedRelation, user)
-
-		if err != nil {
-			return false, err
-		}
-
-		if authorized {
-			return true, nil
-		}
-	}
-
-	return false, nil
-}
-
-// getPermissionHierarchy returns the permission hierarchy for a given relation
-// In order of precedence: owner > editor > viewer
-func (h *ACLHandler) getPermissionHierarchy(relation string) []string {
-	switch relation {
-	case "viewer":
-		return []string{"owner", "editor", "viewer"}
-	case "editor":
-		return []string{"owner", "editor"}
-	case "owner":
-		return []string{"owner"}
-	default:
-		// For unknown relations, only check the exact relation
-		return []string{relation}
-	}
-}
-
-// Invalidate authorization cache when ACLs change
-func (h *ACLHandler) invalidateAuthorizationCache(object, relation, user string) {
-
-	// Invalidate specific check
-	h.redisClient.Delete(fmt.Sprintf("auth:%s:%s:%s", object, relation, user))
-
-	// Invalidate pattern-based cache using Redis SCAN
-	h.redisClient.DeletePattern(fmt.Sprintf("auth:%s:%s:*", object, relation))
-
-	h.redisClient.DeletePattern(fmt.Sprintf("auth:%s:*", object))
-
-	h.logger.Debugw("Invalidated authorization cache", "object", object, "relation", relation, "user", user)
-}
-
 // Authorization check for ACL listing
 func (h *ACLHandler) isAuthorizedForACLListing(c *gin.Context, resource string) bool {
 	// Extract user from context (set by authentication middleware)
@@ -611,7 +1105,8 @@ func (h *ACLHandler) isAuthorizedForACLListing(c *gin.Context, resource string)
 			namespace := parts[0]
 
 			// Check if user can view this namespace's ACLs
-			authorized, err := h.performAuthorizationCheck(
+			authorized, err := h.checker.Check(
+				c.Request.Context(),
 				fmt.Sprintf("namespace:%s", namespace),
 				"view_acls",
 				user.(string),
@@ -626,17 +1121,10 @@ func (h *ACLHandler) isAuthorizedForACLListing(c *gin.Context, resource string)
 	return resource == user.(string)
 }
 
-// getPaginationParams extracts pagination parameters from query
-func (h *ACLHandler) getPaginationParams(c *gin.Context) (int, int) {
-	page := 1
+// getPageSize extracts the page size from query
+func (h *ACLHandler) getPageSize(c *gin.Context) int {
 	pageSize := 50
 
-	if pageStr := c.Query("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
-	}
-
 	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
 		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 {
 			pageSize = ps
@@ -652,7 +1140,7 @@ func (h *ACLHandler) getPaginationParams(c *gin.Context) (int, int) {
 		pageSize = 1
 	}
 
-	return page, pageSize
+	return pageSize
 }
 
 // autoGrantAliceOwnershipForNewDocuments automatically grants alice owner permission for new documents in doc namespace
@@ -668,7 +1156,7 @@ func (h *ACLHandler) autoGrantAliceOwnershipForNewDocuments(object string) error
 	aliceUser := "user:alice"
 
 	// Check if alice already has owner permission for this document
-	hasOwnership, err := h.leveldbClient.CheckTuple(object, "owner", aliceUser)
+	hasOwnership, err := h.tupleStore.CheckTuple(object, "owner", aliceUser)
 	if err != nil {
 		return fmt.Errorf("failed to check existing ownership: %v", err)
 	}
@@ -679,7 +1167,7 @@ func (h *ACLHandler) autoGrantAliceOwnershipForNewDocuments(object string) error
 	}
 
 	// Check if this is truly a new document by seeing if there are any existing ACLs for it
-	existingTuples, err := h.leveldbClient.ListTuplesByObjectAndRelation(object, "owner")
+	existingTuples, err := h.tupleStore.ListTuplesByObjectAndRelation(object, "owner")
 	if err != nil {
 		return fmt.Errorf("failed to check existing document owners: %v", err)
 	}
@@ -692,15 +1180,12 @@ func (h *ACLHandler) autoGrantAliceOwnershipForNewDocuments(object string) error
 			User:     aliceUser,
 		}
 
-		if err := h.leveldbClient.StoreTuple(aliceOwnerTuple); err != nil {
+		if err := h.tupleStore.StoreTuple(aliceOwnerTuple); err != nil {
 			return fmt.Errorf("failed to grant alice ownership: %v", err)
 		}
 
 		h.logger.Infow("Auto-granted alice owner permission for new document",
 			"document", documentID, "object", object, "user", aliceUser)
-
-		// Invalidate cache for alice's new ownership
-		h.invalidateAuthorizationCache(object, "owner", aliceUser)
 	} else {
 		h.logger.Debugw("Document already has owners, not auto-granting alice ownership",
 			"document", documentID, "object", object, "existing_owners", len(existingTuples))
@@ -718,7 +1203,7 @@ func (h *ACLHandler) ensureDocNamespaceExists(object string) error {
 	}
 
 	// Check if doc namespace already exists
-	exists, err := h.consulClient.NamespaceExists("doc")
+	exists, err := h.namespaceStore.NamespaceExists("doc")
 	if err != nil {
 		return fmt.Errorf("failed to check doc namespace existence: %v", err)
 	}
@@ -756,7 +1241,7 @@ func (h *ACLHandler) ensureDocNamespaceExists(object string) error {
 		Version: 1,
 	}
 
-	if err := h.consulClient.StoreNamespace("doc", namespaceConfig); err != nil {
+	if err := h.namespaceStore.StoreNamespace("doc", namespaceConfig); err != nil {
 		return fmt.Errorf("failed to create doc namespace: %v", err)
 	}
 
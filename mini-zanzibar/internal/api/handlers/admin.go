@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/engine"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// adminObject is the object whose admin relation grants access to the
+// admin endpoints
+const adminObject = "system:mini-zanzibar"
+
+type AdminHandler struct {
+	tupleStore database.TupleStore
+	admins     adminAccess
+	logger     *zap.SugaredLogger
+}
+
+// NewAdminHandler creates a new admin handler. adminUser, if set, is an
+// admin without holding the admin relation.
+func NewAdminHandler(tupleStore database.TupleStore, checker *engine.Checker, adminUser string, logger *zap.SugaredLogger) *AdminHandler {
+	return &AdminHandler{
+		tupleStore: tupleStore,
+		admins:     adminAccess{user: adminUser, checker: checker, logger: logger},
+		logger:     logger,
+	}
+}
+
+// CheckIntegrity handles GET /admin/fsck - Report inconsistent index entries
+func (h *AdminHandler) CheckIntegrity(c *gin.Context) {
+	h.checkIntegrity(c, false)
+}
+
+// RepairIntegrity handles POST /admin/fsck - Report and fix inconsistent
+// index entries. Writes are blocked until the repair finishes.
+func (h *AdminHandler) RepairIntegrity(c *gin.Context) {
+	h.checkIntegrity(c, true)
+}
+
+func (h *AdminHandler) checkIntegrity(c *gin.Context, repair bool) {
+	if !h.admins.isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	checker, ok := h.tupleStore.(database.IntegrityChecker)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "the tuple store does not support integrity checks"})
+		return
+	}
+
+	report, err := checker.CheckIntegrity(repair)
+	if err != nil {
+		h.logger.Errorw("failed to check index integrity", "error", err, "repair", repair)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check index integrity"})
+		return
+	}
+
+	h.logger.Infow("Checked index integrity", "issues", report.IssueCounts, "repaired", report.Repaired)
+	c.JSON(http.StatusOK, report)
+}
+
+// adminAccess decides who is an admin: the configured admin user, and
+// every user with the admin relation to the system object. Only admins may
+// grant that relation, so the configured user is the root of all grants.
+type adminAccess struct {
+	user    string
+	checker *engine.Checker
+	logger  *zap.SugaredLogger
+}
+
+// isAdmin reports whether the requesting user is an admin
+func (a adminAccess) isAdmin(c *gin.Context) bool {
+	user, exists := c.Get("user")
+	if !exists {
+		a.logger.Warnw("no user in context for admin request", "path", c.FullPath())
+		return false
+	}
+	return a.allows(c.Request.Context(), user.(string))
+}
+
+// allows reports whether user is an admin
+func (a adminAccess) allows(ctx context.Context, user string) bool {
+	if a.user != "" && user == a.user {
+		return true
+	}
+
+	authorized, err := a.checker.Check(ctx, adminObject, "admin", user)
+	if err != nil {
+		a.logger.Errorw("failed to check admin authorization", "error", err, "user", user)
+		return false
+	}
+	return authorized
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"mini-zanzibar/internal/database"
 	"mini-zanzibar/internal/database/consul"
 	"mini-zanzibar/internal/models"
+	"mini-zanzibar/internal/validation"
 	"net/http"
 	"strconv"
 
@@ -11,15 +13,15 @@ import (
 )
 
 type NamespaceHandler struct {
-	consulClient *consul.Client
-	logger       *zap.SugaredLogger
+	namespaceStore database.NamespaceStore
+	logger         *zap.SugaredLogger
 }
 
 // NewNamespaceHandler creates a new namespace handler
-func NewNamespaceHandler(consulClient *consul.Client, logger *zap.SugaredLogger) *NamespaceHandler {
+func NewNamespaceHandler(namespaceStore database.NamespaceStore, logger *zap.SugaredLogger) *NamespaceHandler {
 	return &NamespaceHandler{
-		consulClient: consulClient,
-		logger:       logger,
+		namespaceStore: namespaceStore,
+		logger:         logger,
 	}
 }
 
@@ -31,16 +33,23 @@ func (h *NamespaceHandler) CreateNamespace(c *gin.Context) {
 		return
 	}
 
-	// TODO: Validate namespace configuration
-	// TODO: Check for circular dependencies in relations
 	// TODO: Implement authorization check for namespace management
 
+	if verr := validation.ValidateNamespace(req); verr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   verr.Message,
+			"code":    verr.Code,
+			"details": verr.Details,
+		})
+		return
+	}
+
 	config := consul.NamespaceConfig{
 		Namespace: req.Namespace,
 		Relations: convertRelationConfig(req.Relations),
 	}
 
-	if err := h.consulClient.StoreNamespace(req.Namespace, config); err != nil {
+	if err := h.namespaceStore.StoreNamespace(req.Namespace, config); err != nil {
 		h.logger.Errorw("Failed to store namespace", "error", err, "namespace", req.Namespace)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store namespace"})
 		return
@@ -64,7 +73,7 @@ func (h *NamespaceHandler) GetNamespace(c *gin.Context) {
 
 	// TODO: Implement authorization check for namespace access
 
-	config, err := h.consulClient.GetNamespace(namespace)
+	config, err := h.namespaceStore.GetNamespace(namespace)
 	if err != nil {
 		h.logger.Errorw("Failed to get namespace", "error", err, "namespace", namespace)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace not found"})
@@ -98,7 +107,7 @@ func (h *NamespaceHandler) GetNamespaceVersion(c *gin.Context) {
 
 	// TODO: Implement authorization check for namespace access
 
-	config, err := h.consulClient.GetNamespaceVersion(namespace, version)
+	config, err := h.namespaceStore.GetNamespaceVersion(namespace, version)
 	if err != nil {
 		h.logger.Errorw("Failed to get namespace version", "error", err, "namespace", namespace, "version", version)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Namespace version not found"})
@@ -119,7 +128,7 @@ func (h *NamespaceHandler) ListNamespaces(c *gin.Context) {
 	// TODO: Implement authorization check for namespace listing
 	// TODO: Add pagination for large result sets
 
-	namespaces, err := h.consulClient.ListNamespaces()
+	namespaces, err := h.namespaceStore.ListNamespaces()
 	if err != nil {
 		h.logger.Errorw("Failed to list namespaces", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list namespaces"})
@@ -144,7 +153,7 @@ func (h *NamespaceHandler) DeleteNamespace(c *gin.Context) {
 	// TODO: Implement authorization check for namespace management
 	// TODO: Check if namespace is in use before deletion
 
-	if err := h.consulClient.DeleteNamespace(namespace); err != nil {
+	if err := h.namespaceStore.DeleteNamespace(namespace); err != nil {
 		h.logger.Errorw("Failed to delete namespace", "error", err, "namespace", namespace)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete namespace"})
 		return
@@ -158,42 +167,112 @@ func (h *NamespaceHandler) DeleteNamespace(c *gin.Context) {
 func convertRelationConfig(relations map[string]models.RelationConfig) map[string]consul.RelationConfig {
 	result := make(map[string]consul.RelationConfig)
 	for name, config := range relations {
-		var unions []consul.UnionConfig
-		for _, union := range config.Union {
-			consulUnion := consul.UnionConfig{}
-			if union.This != nil {
-				consulUnion.This = &consul.ThisConfig{}
-			}
-			if union.ComputedUserset != nil {
-				consulUnion.ComputedUserset = &consul.ComputedUsersetConfig{
-					Relation: union.ComputedUserset.Relation,
-				}
-			}
-			unions = append(unions, consulUnion)
+		result[name] = consul.RelationConfig{
+			Union:        convertUnionConfigs(config.Union),
+			Intersection: convertUnionConfigs(config.Intersection),
+			Exclusion:    convertExclusionConfig(config.Exclusion),
 		}
-		result[name] = consul.RelationConfig{Union: unions}
 	}
 	return result
 }
 
+// convertUnionConfigs converts a list of models.UnionConfig rewrite nodes
+func convertUnionConfigs(unions []models.UnionConfig) []consul.UnionConfig {
+	var result []consul.UnionConfig
+	for _, union := range unions {
+		result = append(result, convertUnionConfig(union))
+	}
+	return result
+}
+
+// convertUnionConfig converts a single models.UnionConfig rewrite node
+func convertUnionConfig(union models.UnionConfig) consul.UnionConfig {
+	consulUnion := consul.UnionConfig{
+		Union:        convertUnionConfigs(union.Union),
+		Intersection: convertUnionConfigs(union.Intersection),
+		Exclusion:    convertExclusionConfig(union.Exclusion),
+	}
+	if union.This != nil {
+		consulUnion.This = &consul.ThisConfig{}
+	}
+	if union.ComputedUserset != nil {
+		consulUnion.ComputedUserset = &consul.ComputedUsersetConfig{
+			Relation: union.ComputedUserset.Relation,
+		}
+	}
+	if union.TupleToUserset != nil {
+		consulUnion.TupleToUserset = &consul.TupleToUsersetConfig{
+			Tupleset:        consul.TuplesetConfig{Relation: union.TupleToUserset.Tupleset.Relation},
+			ComputedUserset: consul.ComputedUsersetConfig{Relation: union.TupleToUserset.ComputedUserset.Relation},
+		}
+	}
+	return consulUnion
+}
+
+// convertExclusionConfig converts a models.ExclusionConfig
+func convertExclusionConfig(exclusion *models.ExclusionConfig) *consul.ExclusionConfig {
+	if exclusion == nil {
+		return nil
+	}
+	return &consul.ExclusionConfig{
+		Base:     convertUnionConfig(exclusion.Base),
+		Subtract: convertUnionConfig(exclusion.Subtract),
+	}
+}
+
 // convertConsulRelationConfig converts consul.RelationConfig to models.RelationConfig
 func convertConsulRelationConfig(relations map[string]consul.RelationConfig) map[string]models.RelationConfig {
 	result := make(map[string]models.RelationConfig)
 	for name, config := range relations {
-		var unions []models.UnionConfig
-		for _, union := range config.Union {
-			modelUnion := models.UnionConfig{}
-			if union.This != nil {
-				modelUnion.This = &models.ThisConfig{}
-			}
-			if union.ComputedUserset != nil {
-				modelUnion.ComputedUserset = &models.ComputedUsersetConfig{
-					Relation: union.ComputedUserset.Relation,
-				}
-			}
-			unions = append(unions, modelUnion)
+		result[name] = models.RelationConfig{
+			Union:        convertConsulUnionConfigs(config.Union),
+			Intersection: convertConsulUnionConfigs(config.Intersection),
+			Exclusion:    convertConsulExclusionConfig(config.Exclusion),
 		}
-		result[name] = models.RelationConfig{Union: unions}
 	}
 	return result
 }
+
+// convertConsulUnionConfigs converts a list of consul.UnionConfig rewrite nodes
+func convertConsulUnionConfigs(unions []consul.UnionConfig) []models.UnionConfig {
+	var result []models.UnionConfig
+	for _, union := range unions {
+		result = append(result, convertConsulUnionConfig(union))
+	}
+	return result
+}
+
+// convertConsulUnionConfig converts a single consul.UnionConfig rewrite node
+func convertConsulUnionConfig(union consul.UnionConfig) models.UnionConfig {
+	modelUnion := models.UnionConfig{
+		Union:        convertConsulUnionConfigs(union.Union),
+		Intersection: convertConsulUnionConfigs(union.Intersection),
+		Exclusion:    convertConsulExclusionConfig(union.Exclusion),
+	}
+	if union.This != nil {
+		modelUnion.This = &models.ThisConfig{}
+	}
+	if union.ComputedUserset != nil {
+		modelUnion.ComputedUserset = &models.ComputedUsersetConfig{
+			Relation: union.ComputedUserset.Relation,
+		}
+	}
+	if union.TupleToUserset != nil {
+		modelUnion.TupleToUserset = &models.TupleToUsersetConfig{
+			Tupleset:        models.TuplesetConfig{Relation: union.TupleToUserset.Tupleset.Relation},
+			ComputedUserset: models.ComputedUsersetConfig{Relation: union.TupleToUserset.ComputedUserset.Relation},
+		}
+	}
+	return modelUnion
+}
+
+// convertConsulExclusionConfig converts a consul.ExclusionConfig
+func convertConsulExclusionConfig(exclusion *consul.ExclusionConfig) *models.ExclusionConfig {
+	if exclusion == nil {
+		return nil
+	}
+	return &models.ExclusionConfig{
+		Base:     convertConsulUnionConfig(exclusion.Base),
+		Subtract: convertConsulUnionConfig(exclusion.Subtract),
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mini-zanzibar/internal/database/leveldb"
+	"mini-zanzibar/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryFlushInterval is the number of tuples written between flushes of a
+// streamed query response
+const queryFlushInterval = 100
+
+// QueryTuples handles GET /tuples - List the tuples matching a filter. The
+// tuples are written to the response as they are read from the index.
+func (h *ACLHandler) QueryTuples(c *gin.Context) {
+	var req models.TupleQueryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := leveldb.TupleFilter{
+		Namespace:      req.Namespace,
+		ObjectID:       req.ObjectID,
+		ObjectIDPrefix: req.ObjectIDPrefix,
+		Relation:       req.Relation,
+		SubjectType:    req.SubjectType,
+		SubjectID:      req.SubjectID,
+	}
+	if err := filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Queries are scoped to a namespace or a subject, whose ACLs the caller
+	// must be allowed to list
+	var resource string
+	switch {
+	case filter.Namespace != "":
+		resource = filter.Namespace + ":"
+	case filter.SubjectType != "" && filter.SubjectID != "":
+		resource = filter.SubjectType + ":" + filter.SubjectID
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "namespace, or subject_type and subject_id, is required"})
+		return
+	}
+
+	if !h.checkFreshness(c) {
+		return
+	}
+
+	if !h.isAuthorizedForACLListing(c, resource) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized to list these ACLs"})
+		return
+	}
+
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+	if pageSize > 1000 {
+		pageSize = 1000
+	}
+
+	stream := &tupleStream{c: c}
+	next, err := h.tupleStore.QueryTuples(filter, req.Cursor, pageSize, stream.write)
+	if err != nil {
+		if stream.started {
+			// The status is sent already, so end the page with an error
+			// instead of a cursor
+			h.logger.Errorw("failed to stream tuple query", "error", err, "request", req)
+			if err := stream.fail("failed to query tuples"); err != nil {
+				h.logger.Errorw("failed to stream tuple query", "error", err, "request", req)
+			}
+			return
+		}
+		if errors.Is(err, leveldb.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		h.logger.Errorw("failed to query tuples", "error", err, "request", req)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query tuples"})
+		return
+	}
+
+	if err := stream.close(next); err != nil {
+		h.logger.Errorw("failed to stream tuple query", "error", err, "request", req)
+	}
+}
+
+// tupleStream writes a tuple page as JSON while the tuples are read, in the
+// format of the tuple listings
+type tupleStream struct {
+	c       *gin.Context
+	started bool
+	written int
+}
+
+// start writes the status and opens the tuple list
+func (s *tupleStream) start() error {
+	s.started = true
+	s.c.Header("Content-Type", "application/json; charset=utf-8")
+	s.c.Status(http.StatusOK)
+	_, err := s.c.Writer.WriteString(`{"tuples":[`)
+	return err
+}
+
+// write appends a tuple to the list
+func (s *tupleStream) write(tuple leveldb.ACLTuple) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	} else if _, err := s.c.Writer.WriteString(","); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(tuple)
+	if err != nil {
+		return err
+	}
+	if _, err := s.c.Writer.Write(encoded); err != nil {
+		return err
+	}
+
+	s.written++
+	if s.written%queryFlushInterval == 0 {
+		s.c.Writer.Flush()
+	}
+	return nil
+}
+
+// close ends the tuple list and adds the cursor of the next page, if any
+func (s *tupleStream) close(next string) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if next == "" {
+		return s.end("", "")
+	}
+	return s.end("next_cursor", next)
+}
+
+// fail ends the tuple list with an error in place of the cursor, marking the
+// page as incomplete
+func (s *tupleStream) fail(message string) error {
+	return s.end("error", message)
+}
+
+// end closes the tuple list and the page, adding the string field if one is
+// named
+func (s *tupleStream) end(field, value string) error {
+	trailer := "]"
+	if field != "" {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		trailer += `,"` + field + `":` + string(encoded)
+	}
+	_, err := s.c.Writer.WriteString(trailer + "}")
+	return err
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/leveldb"
+	"mini-zanzibar/internal/engine"
+	"mini-zanzibar/internal/models"
+	"mini-zanzibar/pkg/zookie"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// watchBatchSize bounds the revisions read from the changelog at once
+	watchBatchSize = 100
+	// defaultWatchTimeout and maxWatchTimeout bound how long a long-poll
+	// watch waits for the next change
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 60 * time.Second
+	// watchHeartbeatInterval is how often an idle event stream sends a
+	// comment to keep proxies from closing it
+	watchHeartbeatInterval = 15 * time.Second
+)
+
+type WatchHandler struct {
+	tupleStore database.TupleStore
+	admins     adminAccess
+	logger     *zap.SugaredLogger
+}
+
+// NewWatchHandler creates a new watch handler. adminUser is an admin like
+// for NewAdminHandler.
+func NewWatchHandler(tupleStore database.TupleStore, checker *engine.Checker, adminUser string, logger *zap.SugaredLogger) *WatchHandler {
+	return &WatchHandler{
+		tupleStore: tupleStore,
+		admins:     adminAccess{user: adminUser, checker: checker, logger: logger},
+		logger:     logger,
+	}
+}
+
+// Watch handles GET /watch - Stream the tuple changes committed after the
+// since cursor. Clients accepting text/event-stream get Server-Sent Events
+// until they disconnect; others long-poll and get the next changes as JSON.
+// The changes span every namespace, so only admins may watch.
+func (h *WatchHandler) Watch(c *gin.Context) {
+	if !h.admins.isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		return
+	}
+
+	since, ok := h.sinceRevision(c)
+	if !ok {
+		return
+	}
+
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		h.stream(c, since)
+		return
+	}
+
+	timeout := defaultWatchTimeout
+	if value := c.Query("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxWatchTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeout must be a duration between 0s and %s", maxWatchTimeout)})
+			return
+		}
+		timeout = parsed
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		// Subscribe before reading, so a commit in between is not missed
+		changed := h.tupleStore.Changed()
+		changeSets, err := h.tupleStore.ReadChanges(since, watchBatchSize)
+		if err != nil {
+			h.readChangesFailed(c, since, err)
+			return
+		}
+
+		if len(changeSets) > 0 {
+			events := make([]models.WatchEvent, len(changeSets))
+			for i, changeSet := range changeSets {
+				events[i] = watchEvent(changeSet)
+			}
+			c.JSON(http.StatusOK, models.WatchResponse{
+				Events:     events,
+				NextCursor: events[len(events)-1].Zookie,
+			})
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			c.JSON(http.StatusOK, models.WatchResponse{
+				Events:     []models.WatchEvent{},
+				NextCursor: zookie.Encode(since),
+			})
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// stream sends the changes after since as Server-Sent Events, one "change"
+// event per revision with the revision's zookie as event ID, until the
+// client disconnects
+func (h *WatchHandler) stream(c *gin.Context, since uint64) {
+	// Report an unusable cursor with a regular error response
+	if _, err := h.tupleStore.ReadChanges(since, 1); err != nil {
+		h.readChangesFailed(c, since, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		changed := h.tupleStore.Changed()
+		changeSets, err := h.tupleStore.ReadChanges(since, watchBatchSize)
+		if errors.Is(err, leveldb.ErrSnapshotExpired) {
+			// Garbage collection overtook the stream; reconnecting with the
+			// same Last-Event-ID cannot succeed
+			h.logger.Warnw("watch stream expired", "since", since)
+			writeServerSentEvent(c, "", "expired", gin.H{"error": "since is older than the retained changelog, resynchronize and watch from the current revision"})
+			c.Writer.Flush()
+			return
+		}
+		if err != nil {
+			h.logger.Warnw("watch stream ended", "error", err, "since", since)
+			writeServerSentEvent(c, "", "error", gin.H{"error": err.Error()})
+			c.Writer.Flush()
+			return
+		}
+
+		for _, changeSet := range changeSets {
+			event := watchEvent(changeSet)
+			if err := writeServerSentEvent(c, event.Zookie, "change", event); err != nil {
+				h.logger.Errorw("failed to write watch event", "error", err)
+				return
+			}
+			since = changeSet.Revision
+		}
+		if len(changeSets) > 0 {
+			c.Writer.Flush()
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// sinceRevision returns the revision of the since cursor, or of the
+// Last-Event-ID header sent by reconnecting event streams. Without either,
+// watching starts at the current revision. It writes an error response and
+// returns false if the cursor is invalid.
+func (h *WatchHandler) sinceRevision(c *gin.Context) (uint64, bool) {
+	cursor := c.Query("since")
+	if cursor == "" {
+		cursor = c.GetHeader("Last-Event-ID")
+	}
+
+	if cursor == "" {
+		revision, err := h.tupleStore.Revision()
+		if err != nil {
+			h.logger.Errorw("failed to read revision", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read revision"})
+			return 0, false
+		}
+		return revision, true
+	}
+
+	since, err := zookie.Decode(cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return since, true
+}
+
+// readChangesFailed writes the error response of a failed changelog read
+func (h *WatchHandler) readChangesFailed(c *gin.Context, since uint64, err error) {
+	switch {
+	case errors.Is(err, leveldb.ErrSnapshotExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "since is older than the retained changelog, resynchronize and watch from the current revision"})
+	case errors.Is(err, leveldb.ErrFutureRevision):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since is newer than the current revision"})
+	default:
+		h.logger.Errorw("failed to read changes", "error", err, "since", since)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read changes"})
+	}
+}
+
+// watchEvent converts a change set to its API representation
+func watchEvent(changeSet leveldb.ChangeSet) models.WatchEvent {
+	event := models.WatchEvent{
+		Zookie:  zookie.Encode(changeSet.Revision),
+		Changes: make([]models.TupleChange, len(changeSet.Changes)),
+	}
+	for i, change := range changeSet.Changes {
+		event.Changes[i] = models.TupleChange{
+			Operation: change.Operation,
+			Tuple:     models.ACLTuple(change.Tuple),
+		}
+	}
+	return event
+}
+
+// writeServerSentEvent writes a single event of an event stream, with data
+// encoded as JSON. An empty id leaves the client's last event ID unchanged.
+func writeServerSentEvent(c *gin.Context, id, event string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		fmt.Fprintf(c.Writer, "id: %s\n", id)
+	}
+	_, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, encoded)
+	return err
+}
@@ -4,16 +4,16 @@ import (
 	"mini-zanzibar/internal/api/handlers"
 	"mini-zanzibar/internal/api/middleware"
 	"mini-zanzibar/internal/config"
-	"mini-zanzibar/internal/database/consul"
-	"mini-zanzibar/internal/database/leveldb"
+	"mini-zanzibar/internal/database"
 	"mini-zanzibar/internal/database/redis"
+	"mini-zanzibar/internal/engine"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 // NewRouter creates and configures the API router
-func NewRouter(leveldbClient *leveldb.Client, consulClient *consul.Client, redisClient *redis.Client, logger *zap.SugaredLogger, cfg *config.Config) *gin.Engine {
+func NewRouter(tupleStore database.TupleStore, namespaceStore database.NamespaceStore, redisClient *redis.Client, logger *zap.SugaredLogger, cfg *config.Config) *gin.Engine {
 	// Set Gin mode based on environment
 	if cfg.LogLevel != "debug" {
 		gin.SetMode(gin.ReleaseMode)
@@ -33,8 +33,11 @@ func NewRouter(leveldbClient *leveldb.Client, consulClient *consul.Client, redis
 	router.Use(middleware.RateLimit(cfg.RateLimitRequests, cfg.RateLimitWindow))
 
 	// Initialize handlers
-	aclHandler := handlers.NewACLHandler(leveldbClient, consulClient, redisClient, logger)
-	namespaceHandler := handlers.NewNamespaceHandler(consulClient, logger)
+	checker := engine.NewChecker(tupleStore, namespaceStore, cfg.CheckMaxDepth)
+	aclHandler := handlers.NewACLHandler(tupleStore, namespaceStore, redisClient, checker, cfg.AdminUser, cfg.CheckBatchMaxItems, logger)
+	namespaceHandler := handlers.NewNamespaceHandler(namespaceStore, logger)
+	watchHandler := handlers.NewWatchHandler(tupleStore, checker, cfg.AdminUser, logger)
+	adminHandler := handlers.NewAdminHandler(tupleStore, checker, cfg.AdminUser, logger)
 	healthHandler := handlers.NewHealthHandler(logger)
 
 	// Health check endpoint
@@ -45,10 +48,24 @@ func NewRouter(leveldbClient *leveldb.Client, consulClient *consul.Client, redis
 	{
 		// ACL endpoints
 		v1.POST("/acl", aclHandler.CreateACL)
+		v1.POST("/acl/write", aclHandler.WriteACL)
 		v1.GET("/acl/check", aclHandler.CheckACL)
+		v1.POST("/acl/check", aclHandler.CheckACLWithContext)
+		v1.POST("/acl/check/batch", aclHandler.BatchCheckACL)
+		v1.GET("/acl/expand", aclHandler.ExpandACL)
+		v1.GET("/acl/lookup-resources", aclHandler.LookupResources)
+		v1.GET("/acl/lookup-subjects", aclHandler.LookupSubjects)
 		v1.DELETE("/acl", aclHandler.DeleteACL)
 		v1.GET("/acl/object/:object", aclHandler.ListACLsByObject)
 		v1.GET("/acl/user/:user", aclHandler.ListACLsByUser)
+		v1.GET("/tuples", aclHandler.QueryTuples)
+
+		// Changelog endpoint
+		v1.GET("/watch", watchHandler.Watch)
+
+		// Admin endpoints
+		v1.GET("/admin/fsck", adminHandler.CheckIntegrity)
+		v1.POST("/admin/fsck", adminHandler.RepairIntegrity)
 
 		// Namespace endpoints
 		v1.POST("/namespace", namespaceHandler.CreateNamespace)
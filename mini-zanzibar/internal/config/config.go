@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -15,12 +17,24 @@ type Config struct {
 
 	// Database configuration
 	LevelDBPath string
+	// TupleHistoryRetention is how long old tuple versions and the
+	// changelog are kept; TupleGCInterval is how often older ones are removed
+	TupleHistoryRetention time.Duration
+	TupleGCInterval       time.Duration
+
+	// Namespace store configuration ("consul", "file" or "memory")
+	NamespaceBackend string
+	NamespaceDir     string
 
 	// Consul configuration
 	ConsulAddress    string
 	ConsulDatacenter string
 	ConsulToken      string
 
+	// Check engine configuration
+	CheckMaxDepth      int
+	CheckBatchMaxItems int
+
 	// Redis configuration
 	RedisAddress  string
 	RedisPassword string
@@ -35,6 +49,9 @@ type Config struct {
 	LogFormat string
 
 	// Security configuration
+	// AdminUser is an admin without holding the admin relation, e.g.
+	// user:root, who grants it to the other admins
+	AdminUser         string
 	EnableCORS        bool
 	RateLimitRequests int
 	RateLimitWindow   time.Duration
@@ -45,20 +62,43 @@ func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		ServerHost:        getEnvString("SERVER_HOST", "localhost"),
-		ServerPort:        getEnvString("SERVER_PORT", "8080"),
-		LevelDBPath:       getEnvString("LEVELDB_PATH", "./data/leveldb"),
-		ConsulAddress:     getEnvString("CONSUL_ADDRESS", "localhost:8500"),
-		ConsulDatacenter:  getEnvString("CONSUL_DATACENTER", "dc1"),
-		ConsulToken:       getEnvString("CONSUL_TOKEN", ""),
-		RedisAddress:      getEnvString("REDIS_ADDRESS", "localhost:6379"),
-		RedisPassword:     getEnvString("REDIS_PASSWORD", ""),
-		RedisDB:           getEnvInt("REDIS_DB", 0),
-		JWTSecret:         getEnvString("JWT_SECRET", "your-secret-key-here"),
-		LogLevel:          getEnvString("LOG_LEVEL", "info"),
-		LogFormat:         getEnvString("LOG_FORMAT", "json"),
-		EnableCORS:        getEnvBool("ENABLE_CORS", true),
-		RateLimitRequests: getEnvInt("RATE_LIMIT_REQUESTS", 100),
+		ServerHost:         getEnvString("SERVER_HOST", "localhost"),
+		ServerPort:         getEnvString("SERVER_PORT", "8080"),
+		LevelDBPath:        getEnvString("LEVELDB_PATH", "./data/leveldb"),
+		NamespaceBackend:   getEnvString("NAMESPACE_BACKEND", "consul"),
+		NamespaceDir:       getEnvString("NAMESPACE_DIR", "./data/namespaces"),
+		ConsulAddress:      getEnvString("CONSUL_ADDRESS", "localhost:8500"),
+		ConsulDatacenter:   getEnvString("CONSUL_DATACENTER", "dc1"),
+		ConsulToken:        getEnvString("CONSUL_TOKEN", ""),
+		CheckMaxDepth:      getEnvInt("CHECK_MAX_DEPTH", 25),
+		CheckBatchMaxItems: getEnvInt("CHECK_BATCH_MAX_ITEMS", 100),
+		RedisAddress:       getEnvString("REDIS_ADDRESS", "localhost:6379"),
+		RedisPassword:      getEnvString("REDIS_PASSWORD", ""),
+		RedisDB:            getEnvInt("REDIS_DB", 0),
+		JWTSecret:          getEnvString("JWT_SECRET", "your-secret-key-here"),
+		LogLevel:           getEnvString("LOG_LEVEL", "info"),
+		LogFormat:          getEnvString("LOG_FORMAT", "json"),
+		AdminUser:          getEnvString("ADMIN_USER", ""),
+		EnableCORS:         getEnvBool("ENABLE_CORS", true),
+		RateLimitRequests:  getEnvInt("RATE_LIMIT_REQUESTS", 100),
+	}
+
+	switch cfg.NamespaceBackend {
+	case "consul", "file", "memory":
+	default:
+		return nil, fmt.Errorf("unknown NAMESPACE_BACKEND %q (expected consul, file or memory)", cfg.NamespaceBackend)
+	}
+
+	if cfg.CheckMaxDepth <= 0 {
+		return nil, fmt.Errorf("invalid CHECK_MAX_DEPTH %d (must be positive)", cfg.CheckMaxDepth)
+	}
+
+	if cfg.CheckBatchMaxItems <= 0 {
+		return nil, fmt.Errorf("invalid CHECK_BATCH_MAX_ITEMS %d (must be positive)", cfg.CheckBatchMaxItems)
+	}
+
+	if cfg.AdminUser != "" && !strings.Contains(cfg.AdminUser, ":") {
+		return nil, fmt.Errorf("invalid ADMIN_USER %q (expected type:id, e.g. user:root)", cfg.AdminUser)
 	}
 
 	// Parse JWT expiry
@@ -77,6 +117,14 @@ func Load() (*Config, error) {
 	}
 	cfg.RateLimitWindow = rateLimitWindow
 
+	// Parse tuple history retention and garbage collection interval
+	if cfg.TupleHistoryRetention, err = time.ParseDuration(getEnvString("TUPLE_HISTORY_RETENTION", "168h")); err != nil {
+		return nil, fmt.Errorf("invalid TUPLE_HISTORY_RETENTION: %w", err)
+	}
+	if cfg.TupleGCInterval, err = time.ParseDuration(getEnvString("TUPLE_GC_INTERVAL", "1h")); err != nil {
+		return nil, fmt.Errorf("invalid TUPLE_GC_INTERVAL: %w", err)
+	}
+
 	return cfg, nil
 }
 
@@ -20,12 +20,23 @@ type NamespaceConfig struct {
 }
 
 type RelationConfig struct {
-	Union []UnionConfig `json:"union,omitempty"`
+	Union        []UnionConfig    `json:"union,omitempty"`
+	Intersection []UnionConfig    `json:"intersection,omitempty"`
+	Exclusion    *ExclusionConfig `json:"exclusion,omitempty"`
 }
 
 type UnionConfig struct {
 	This            *ThisConfig            `json:"this,omitempty"`
 	ComputedUserset *ComputedUsersetConfig `json:"computed_userset,omitempty"`
+	TupleToUserset  *TupleToUsersetConfig  `json:"tuple_to_userset,omitempty"`
+	Union           []UnionConfig          `json:"union,omitempty"`
+	Intersection    []UnionConfig          `json:"intersection,omitempty"`
+	Exclusion       *ExclusionConfig       `json:"exclusion,omitempty"`
+}
+
+type ExclusionConfig struct {
+	Base     UnionConfig `json:"base"`
+	Subtract UnionConfig `json:"subtract"`
 }
 
 type ThisConfig struct{}
@@ -34,6 +45,15 @@ type ComputedUsersetConfig struct {
 	Relation string `json:"relation"`
 }
 
+type TupleToUsersetConfig struct {
+	Tupleset        TuplesetConfig        `json:"tupleset"`
+	ComputedUserset ComputedUsersetConfig `json:"computed_userset"`
+}
+
+type TuplesetConfig struct {
+	Relation string `json:"relation"`
+}
+
 // NewClient creates a new Consul client
 func NewClient(address, datacenter, token string) (*Client, error) {
 	config := api.DefaultConfig()
@@ -0,0 +1,229 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mini-zanzibar/internal/database/consul"
+)
+
+// Client stores namespace configurations as a directory of JSON files,
+// using the same layout as the Consul key space:
+//
+//	<dir>/<namespace>/versions/<version>.json
+//	<dir>/<namespace>/latest
+type Client struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewClient creates a new file-backed namespace client rooted at dir
+func NewClient(dir string) (*Client, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create namespace directory: %w", err)
+	}
+
+	return &Client{
+		dir: dir,
+	}, nil
+}
+
+// StoreNamespace stores a namespace configuration with versioning
+func (c *Client) StoreNamespace(namespace string, config consul.NamespaceConfig) error {
+	if err := validateName(namespace); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Get current version
+	currentVersion, err := c.getLatestVersion(namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get current version: %w", err)
+	}
+
+	// Increment version
+	config.Version = currentVersion + 1
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal namespace config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(c.dir, namespace, "versions"), 0o755); err != nil {
+		return fmt.Errorf("failed to create namespace directory: %w", err)
+	}
+
+	// Store versioned configuration
+	if err := writeFileAtomic(c.getVersionedPath(namespace, config.Version), data); err != nil {
+		return fmt.Errorf("failed to store namespace config: %w", err)
+	}
+
+	// Update latest pointer
+	if err := writeFileAtomic(c.getLatestPath(namespace), []byte(strconv.Itoa(config.Version))); err != nil {
+		return fmt.Errorf("failed to update latest version pointer: %w", err)
+	}
+
+	return nil
+}
+
+// GetNamespace retrieves the latest namespace configuration
+func (c *Client) GetNamespace(namespace string) (*consul.NamespaceConfig, error) {
+	if err := validateName(namespace); err != nil {
+		return nil, err
+	}
+
+	version, err := c.getLatestVersion(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest version: %w", err)
+	}
+
+	if version == 0 {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+
+	return c.GetNamespaceVersion(namespace, version)
+}
+
+// GetNamespaceVersion retrieves a specific version of namespace configuration
+func (c *Client) GetNamespaceVersion(namespace string, version int) (*consul.NamespaceConfig, error) {
+	if err := validateName(namespace); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(c.getVersionedPath(namespace, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("namespace version not found: %s v%d", namespace, version)
+		}
+		return nil, fmt.Errorf("failed to get namespace config: %w", err)
+	}
+
+	var config consul.NamespaceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal namespace config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// ListNamespaces returns all available namespaces
+func (c *Client) ListNamespaces() ([]string, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	var namespaces []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			namespaces = append(namespaces, entry.Name())
+		}
+	}
+
+	return namespaces, nil
+}
+
+// DeleteNamespace removes all versions of a namespace
+func (c *Client) DeleteNamespace(namespace string) error {
+	if err := validateName(namespace); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(c.dir, namespace)); err != nil {
+		return fmt.Errorf("failed to delete namespace: %w", err)
+	}
+
+	return nil
+}
+
+// NamespaceExists checks if a namespace exists. Names that cannot be stored
+// do not exist, like in the other backends.
+func (c *Client) NamespaceExists(namespace string) (bool, error) {
+	if err := validateName(namespace); err != nil {
+		return false, nil
+	}
+
+	version, err := c.getLatestVersion(namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to check namespace existence: %w", err)
+	}
+
+	return version > 0, nil
+}
+
+// RelationExists check if a relation is valid for a namespace
+func (c *Client) RelationExists(namespace, relation string) (bool, error) {
+	config, err := c.GetNamespace(namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	_, exists := config.Relations[relation]
+	return exists, nil
+}
+
+// getLatestVersion retrieves the latest version number for a namespace
+func (c *Client) getLatestVersion(namespace string) (int, error) {
+	data, err := os.ReadFile(c.getLatestPath(namespace))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil // No versions exist yet
+		}
+		return 0, fmt.Errorf("failed to get latest version: %w", err)
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse version: %w", err)
+	}
+
+	return version, nil
+}
+
+// getVersionedPath returns the file path for a specific namespace version
+func (c *Client) getVersionedPath(namespace string, version int) string {
+	return filepath.Join(c.dir, namespace, "versions", fmt.Sprintf("%d.json", version))
+}
+
+// getLatestPath returns the file path for the latest version pointer
+func (c *Client) getLatestPath(namespace string) string {
+	return filepath.Join(c.dir, namespace, "latest")
+}
+
+// validateName rejects namespace names that would escape the store directory
+func validateName(namespace string) error {
+	if namespace == "" || namespace == "." || namespace == ".." || strings.ContainsAny(namespace, `/\`) {
+		return fmt.Errorf("invalid namespace name: %q", namespace)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+// so readers never observe a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
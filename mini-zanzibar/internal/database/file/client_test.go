@@ -0,0 +1,36 @@
+package file_test
+
+import (
+	"testing"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/file"
+	"mini-zanzibar/internal/database/storetest"
+)
+
+func TestNamespaceStoreConformance(t *testing.T) {
+	storetest.RunNamespaceStoreTests(t, func(t *testing.T) database.NamespaceStore {
+		client, err := file.NewClient(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		return client
+	})
+}
+
+func TestRejectsPathTraversal(t *testing.T) {
+	client, err := file.NewClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	for _, name := range []string{"..", "../etc", "a/b", `a\b`, ""} {
+		if err := client.StoreNamespace(name, consul.NamespaceConfig{Namespace: name}); err == nil {
+			t.Errorf("StoreNamespace(%q) succeeded, want error", name)
+		}
+		if _, err := client.GetNamespace(name); err == nil {
+			t.Errorf("GetNamespace(%q) succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// changelogPrefix maps every revision to the JSON list of changes it committed
+const changelogPrefix = "\x00l/"
+
+// Operations of a tuple change
+const (
+	// OperationTouch stores a tuple, whether or not it already existed
+	OperationTouch = "touch"
+	// OperationDelete removes a tuple, whether or not it existed
+	OperationDelete = "delete"
+)
+
+// Change is a single tuple write of a commit
+type Change struct {
+	Operation string   `json:"operation"`
+	Tuple     ACLTuple `json:"tuple"`
+}
+
+// ChangeSet lists the changes committed at a revision
+type ChangeSet struct {
+	Revision uint64   `json:"revision"`
+	Changes  []Change `json:"changes"`
+}
+
+// changelogKey formats the changelog key of revision
+func changelogKey(revision uint64) []byte {
+	return append([]byte(changelogPrefix), encodeRevision(revision)...)
+}
+
+// ReadChanges returns the change sets committed after revision since, oldest
+// first and at most limit of them. It fails with ErrSnapshotExpired if
+// changes after since have been garbage collected, and with
+// ErrFutureRevision if since has not been committed yet.
+func (c *Client) ReadChanges(since uint64, limit int) ([]ChangeSet, error) {
+	if err := c.checkSnapshot(since); err != nil {
+		return nil, err
+	}
+
+	iter := c.db.NewIterator(&util.Range{
+		Start: changelogKey(since + 1),
+		Limit: util.BytesPrefix([]byte(changelogPrefix)).Limit,
+	}, nil)
+	defer iter.Release()
+
+	var changeSets []ChangeSet
+	for iter.Next() {
+		if limit > 0 && len(changeSets) == limit {
+			break
+		}
+
+		changeSet := ChangeSet{Revision: binary.BigEndian.Uint64(iter.Key()[len(changelogPrefix):])}
+		if err := json.Unmarshal(iter.Value(), &changeSet.Changes); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal changes of revision %d: %w", changeSet.Revision, err)
+		}
+		changeSets = append(changeSets, changeSet)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	// Garbage collection may have removed changes while reading
+	if err := c.checkSnapshot(since); err != nil {
+		return nil, err
+	}
+
+	return changeSets, nil
+}
+
+// Changed returns a channel that is closed by the next commit
+func (c *Client) Changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.changed
+}
@@ -1,9 +1,13 @@
 package leveldb
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -11,6 +15,23 @@ import (
 
 type Client struct {
 	db *leveldb.DB
+
+	// mu serializes writes so every write commits the next revision
+	mu       sync.Mutex
+	revision uint64
+	// oldest is the oldest revision snapshots can still read
+	oldest uint64
+	// changed is closed and replaced by every commit
+	changed chan struct{}
+
+	// migrating is set while the string key layout is migrated in the
+	// background. stop ends the migration, and migrated is closed once it
+	// returned migrationErr.
+	migrating    atomic.Bool
+	stop         chan struct{}
+	stopOnce     sync.Once
+	migrated     chan struct{}
+	migrationErr error
 }
 
 type ACLTuple struct {
@@ -19,24 +40,169 @@ type ACLTuple struct {
 	User     string `json:"user"`
 }
 
-// NewClient creates a new LevelDB client
+// TupleReader is the read side of a tuple store
+type TupleReader interface {
+	GetTuple(object, relation, user string) (*ACLTuple, error)
+	CheckTuple(object, relation, user string) (bool, error)
+	ListTuplesByObject(object string) ([]ACLTuple, error)
+	ListTuplesByObjectAndRelation(object, relation string) ([]ACLTuple, error)
+	ListTuplesByUser(user string) ([]ACLTuple, error)
+	ListTuplesByUserAndRelation(user, relation string) ([]ACLTuple, error)
+}
+
+// NewClient creates a new LevelDB client. Databases written by older
+// versions are upgraded: the relation index and the tuple history are built
+// before it returns, and tuples stored with the string key layout are
+// migrated in the background while the client serves reads and writes.
 func NewClient(dbPath string) (*Client, error) {
 	db, err := leveldb.OpenFile(dbPath, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open LevelDB: %w", err)
 	}
 
-	return &Client{
-		db: db,
-	}, nil
+	client := &Client{
+		db:       db,
+		changed:  make(chan struct{}),
+		stop:     make(chan struct{}),
+		migrated: make(chan struct{}),
+	}
+
+	if client.revision, err = readRevision(db, revisionKey); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read revision: %w", err)
+	}
+	if client.oldest, err = readRevision(db, oldestKey); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read oldest revision: %w", err)
+	}
+
+	if err := client.detectMigration(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read key layout: %w", err)
+	}
+
+	if err := client.ensureRelationIndex(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to build relation index: %w", err)
+	}
+
+	if err := client.ensureHistory(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize tuple history: %w", err)
+	}
+
+	if err := client.ensureRelationHistory(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to build relation index history: %w", err)
+	}
+
+	go func() {
+		defer close(client.migrated)
+		client.migrationErr = client.MigrateExistingData()
+	}()
+	return client, nil
+}
+
+// Revision returns the revision of the last committed write. Every
+// StoreTuple and DeleteTuple commits a new, higher revision.
+func (c *Client) Revision() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.revision, nil
 }
 
-// Close closes the LevelDB connection
+// commit applies changes to the primary, reverse and relation index in a
+// single batch, together with their history, the changelog entry and the next
+// revision. Preconditions are checked under the write lock, so no other
+// write can invalidate them before the batch is written.
+func (c *Client) commit(changes []Change, preconditions []Precondition) error {
+	preconditions = append(CreatePreconditions(changes), preconditions...)
+	changes, err := NormalizeChanges(changes)
+	if err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(changes))
+	for i, change := range changes {
+		if change.Operation == OperationDelete {
+			continue
+		}
+		value, err := json.Marshal(change.Tuple)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tuple: %w", err)
+		}
+		values[i] = value
+	}
+
+	changelog, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal changes: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := CheckPreconditions(preconditions, func(tuple ACLTuple) (bool, error) {
+		return c.CheckTuple(tuple.Object, tuple.Relation, tuple.User)
+	}); err != nil {
+		return err
+	}
+
+	revision := c.revision + 1
+	batch := new(leveldb.Batch)
+	for i, change := range changes {
+		primaryKey := c.formatTupleKey(change.Tuple)
+		reverseKey := c.formatReverseKey(change.Tuple)
+		relationKey := c.formatRelationKey(change.Tuple)
+
+		if change.Operation == OperationDelete {
+			batch.Delete(primaryKey)
+			batch.Delete(reverseKey)
+			batch.Delete(relationKey)
+		} else {
+			batch.Put(primaryKey, values[i])
+			batch.Put(reverseKey, []byte{}) // Reverse index doesn't need value, just the key
+			batch.Put(relationKey, []byte{})
+		}
+
+		// The string layout entries go too, so reads merging both layouts
+		// during the migration see the tuple only as written here
+		if c.migrating.Load() {
+			batch.Delete([]byte(stringTupleKey(change.Tuple)))
+			batch.Delete([]byte(stringReverseKey(change.Tuple)))
+		}
+
+		// An empty history value marks the tuple as deleted from revision on
+		batch.Put(objectHistoryKey(change.Tuple, revision), values[i])
+		batch.Put(userHistoryKey(change.Tuple, revision), values[i])
+		batch.Put(relationHistoryKey(change.Tuple, revision), values[i])
+	}
+
+	commitTime := make([]byte, 8)
+	binary.BigEndian.PutUint64(commitTime, uint64(time.Now().UnixNano()))
+	batch.Put(revisionKey, encodeRevision(revision))
+	batch.Put(commitKey(revision), commitTime)
+	batch.Put(changelogKey(revision), changelog)
+
+	if err := c.db.Write(batch, nil); err != nil {
+		return err
+	}
+
+	c.revision = revision
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return nil
+}
+
+// Close stops the key layout migration and closes the LevelDB connection
 func (c *Client) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.migrated
 	return c.db.Close()
 }
 
-// StoreTuple stores an ACL tuple in the format: object#relation@user
+// StoreTuple stores an ACL tuple in the primary, reverse and relation index
 func (c *Client) StoreTuple(tuple ACLTuple) error {
 	// key := c.formatTupleKey(tuple)
 	// value, err := json.Marshal(tuple)
@@ -46,44 +212,19 @@ func (c *Client) StoreTuple(tuple ACLTuple) error {
 
 	// return c.db.Put([]byte(key), value, nil)
 
-	// Primary key: object#relation@user
-	primaryKey := c.formatTupleKey(tuple)
-
-	// Reverse index key: user@object#relation
-	reverseKey := c.formatReverseKey(tuple)
-
-	value, err := json.Marshal(tuple)
-	if err != nil {
-		return fmt.Errorf("failed to marshal tuple: %w", err)
-	}
-
-	// Use batch for atomic operation
-	batch := new(leveldb.Batch)
-	batch.Put([]byte(primaryKey), value)
-	batch.Put([]byte(reverseKey), []byte{}) // Reverse index doesn't need value, just the key
-
-	return c.db.Write(batch, nil)
+	// All index keys are written in one batch
+	return c.commit([]Change{{Operation: OperationTouch, Tuple: tuple}}, nil)
 }
 
 // GetTuple retrieves a specific ACL tuple
 func (c *Client) GetTuple(object, relation, user string) (*ACLTuple, error) {
-	tuple := ACLTuple{Object: object, Relation: relation, User: user}
-	key := c.formatTupleKey(tuple)
-
-	value, err := c.db.Get([]byte(key), nil)
+	v, err := c.newView()
 	if err != nil {
-		if err == leveldb.ErrNotFound {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get tuple: %w", err)
-	}
-
-	var result ACLTuple
-	if err := json.Unmarshal(value, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal tuple: %w", err)
+		return nil, err
 	}
+	defer v.release()
 
-	return &result, nil
+	return v.getTuple(ACLTuple{Object: object, Relation: relation, User: user})
 }
 
 // DeleteTuple removes an ACL tuple
@@ -93,78 +234,18 @@ func (c *Client) DeleteTuple(object, relation, user string) error {
 
 	// return c.db.Delete([]byte(key), nil)
 	tuple := ACLTuple{Object: object, Relation: relation, User: user}
-	primaryKey := c.formatTupleKey(tuple)
-	reverseKey := c.formatReverseKey(tuple)
-
-	// Use batch for atomic operation
-	batch := new(leveldb.Batch)
-	batch.Delete([]byte(primaryKey))
-	batch.Delete([]byte(reverseKey))
-
-	return c.db.Write(batch, nil)
+	return c.commit([]Change{{Operation: OperationDelete, Tuple: tuple}}, nil)
 }
 
 // ListTuplesByObject returns all tuples for a specific object
 func (c *Client) ListTuplesByObject(object string) ([]ACLTuple, error) {
-	prefix := object + "#"
-	iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
-	defer iter.Release()
-
-	var tuples []ACLTuple
-	for iter.Next() {
-		var tuple ACLTuple
-		if err := json.Unmarshal(iter.Value(), &tuple); err != nil {
-			continue // Skip malformed entries
-		}
-		tuples = append(tuples, tuple)
-	}
-
-	return tuples, iter.Error()
+	return c.listPrimary(encodeKey(primaryPrefix, object))
 }
 
 // ListTuplesByUser returns all tuples for a specific user (USING REVERSE INDEX)
 func (c *Client) ListTuplesByUser(user string) ([]ACLTuple, error) {
-	// TODO: Implement efficient user-based querying
-	// For now, we'll scan all keys and filter by user
-	// iter := c.db.NewIterator(nil, nil)
-	// defer iter.Release()
-
-	// var tuples []ACLTuple
-	// for iter.Next() {
-	// 	var tuple ACLTuple
-	// 	if err := json.Unmarshal(iter.Value(), &tuple); err != nil {
-	// 		continue // Skip malformed entries
-	// 	}
-	// 	if tuple.User == user {
-	// 		tuples = append(tuples, tuple)
-	// 	}
-	// }
-
-	// return tuples, iter.Error()
-
 	// Use reverse index for efficient querying
-	prefix := user + "@"
-	iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
-	defer iter.Release()
-
-	var tuples []ACLTuple
-	for iter.Next() {
-		// Parse the reverse key to get object and relation
-		object, relation, parsedUser, err := c.parseReverseKey(string(iter.Key()))
-		if err != nil {
-			continue // Skip malformed entries
-		}
-
-		// Get the actual tuple using primary key
-		tuple, err := c.GetTuple(object, relation, parsedUser)
-		if err != nil || tuple == nil {
-			continue // Skip if tuple not found
-		}
-
-		tuples = append(tuples, *tuple)
-	}
-
-	return tuples, iter.Error()
+	return c.listReverse(encodeKey(reversePrefix, user))
 }
 
 // CheckTuple checks if a specific tuple exists
@@ -176,62 +257,23 @@ func (c *Client) CheckTuple(object, relation, user string) (bool, error) {
 	return tuple != nil, nil
 }
 
-// formatTupleKey formats the tuple key in the format: object#relation@user
-func (c *Client) formatTupleKey(tuple ACLTuple) string {
-	return fmt.Sprintf("%s#%s@%s", tuple.Object, tuple.Relation, tuple.User)
-}
-
-// formatReverseKey formats the reverse index key in the format: user@object#relation
-func (c *Client) formatReverseKey(tuple ACLTuple) string {
-	return fmt.Sprintf("%s@%s#%s", tuple.User, tuple.Object, tuple.Relation)
-}
-
-// parseTupleKey parses a tuple key back into components
-func (c *Client) parseTupleKey(key string) (object, relation, user string, err error) {
-	// Split by '@' to separate user
-	parts := strings.Split(key, "@")
-	if len(parts) != 2 {
-		return "", "", "", fmt.Errorf("invalid tuple key format: missing @")
-	}
-	user = parts[1]
-
-	// Split by '#' to separate object and relation
-	objRelParts := strings.Split(parts[0], "#")
-	if len(objRelParts) != 2 {
-		return "", "", "", fmt.Errorf("invalid tuple key format: missing #")
-	}
-	object = objRelParts[0]
-	relation = objRelParts[1]
-
-	return object, relation, user, nil
+// ListTuplesByObjectAndRelation returns all tuples for a specific object and relation
+func (c *Client) ListTuplesByObjectAndRelation(object, relation string) ([]ACLTuple, error) {
+	return c.listPrimary(encodeKey(primaryPrefix, object, relation))
 }
 
-// parseReverseKey parses a reverse index key back into components
-func (c *Client) parseReverseKey(key string) (object, relation, user string, err error) {
-	// Split by '@' to separate user
-	parts := strings.Split(key, "@")
-	if len(parts) != 2 {
-		return "", "", "", fmt.Errorf("invalid reverse key format: missing @")
+// listPrimary returns the tuples of the primary index under prefix
+func (c *Client) listPrimary(prefix []byte) ([]ACLTuple, error) {
+	v, err := c.newView()
+	if err != nil {
+		return nil, err
 	}
-	user = parts[0]
+	defer v.release()
 
-	// Split by '#' to separate object and relation
-	objRelParts := strings.Split(parts[1], "#")
-	if len(objRelParts) != 2 {
-		return "", "", "", fmt.Errorf("invalid reverse key format: missing #")
+	iter, err := v.newIterator(prefix, util.BytesPrefix(prefix))
+	if err != nil {
+		return nil, err
 	}
-
-	object = objRelParts[0]
-	relation = objRelParts[1]
-
-	return object, relation, user, nil
-
-}
-
-// ListTuplesByObjectAndRelation returns all tuples for a specific object and relation
-func (c *Client) ListTuplesByObjectAndRelation(object, relation string) ([]ACLTuple, error) {
-	prefix := fmt.Sprintf("%s#%s@", object, relation)
-	iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
 	defer iter.Release()
 
 	var tuples []ACLTuple
@@ -245,151 +287,158 @@ func (c *Client) ListTuplesByObjectAndRelation(object, relation string) ([]ACLTu
 	return tuples, iter.Error()
 }
 
-// ListTuplesByObjectPagination returns paginated tuples for a specific object
-func (c *Client) ListTuplesByObjectPagination(object string, page, pageSize int) ([]ACLTuple, int, error) {
-	prefix := object + "#"
-	iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
-	defer iter.Release()
-
-	var tuples []ACLTuple
-	total := 0
-	skip := (page - 1) * pageSize
-	count := 0
-
-	for iter.Next() {
-		total++
-		if count < skip {
-			count++
-			continue
-		}
-
-		if len(tuples) >= pageSize {
-			continue
-		}
-
-		var tuple ACLTuple
-		if err := json.Unmarshal(iter.Value(), &tuple); err != nil {
-			continue // Skip malformed entries
-		}
-		tuples = append(tuples, tuple)
-		count++
+// listReverse returns the tuples of the reverse index under prefix, as
+// stored in the primary index
+func (c *Client) listReverse(prefix []byte) ([]ACLTuple, error) {
+	v, err := c.newView()
+	if err != nil {
+		return nil, err
 	}
+	defer v.release()
 
-	return tuples, total, iter.Error()
-}
-
-// ListTuplesByUserPagination returns paginated tuples for a specific user (USING REVERSE INDEX)
-func (c *Client) ListTuplesByUserPagination(user string, page, pageSize int) ([]ACLTuple, int, error) {
-	// Use reverse index for efficient pagination
-	prefix := user + "@"
-	iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	iter, err := v.newIterator(prefix, util.BytesPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
 	defer iter.Release()
 
 	var tuples []ACLTuple
-	total := 0
-	skip := (page - 1) * pageSize
-	count := 0
-
 	for iter.Next() {
-		total++
-		if count < skip {
-			count++
-			continue
-		}
-
-		if len(tuples) >= pageSize {
-			continue
-		}
-
-		// Parse the reverse key to get object and relation
-		object, relation, parsedUser, err := c.parseReverseKey(string(iter.Key()))
+		entry, err := c.parseReverseKey(iter.Key())
 		if err != nil {
 			continue // Skip malformed entries
 		}
 
 		// Get the actual tuple using primary key
-		tuple, err := c.GetTuple(object, relation, parsedUser)
+		tuple, err := v.getTuple(entry)
 		if err != nil || tuple == nil {
 			continue // Skip if tuple not found
 		}
 
 		tuples = append(tuples, *tuple)
-		count++
 	}
+	return tuples, iter.Error()
+}
 
-	return tuples, total, iter.Error()
+// ListTuplesByObjectPagination returns a page of at most pageSize tuples for
+// a specific object, starting after cursor, and the cursor of the next page,
+// or "" if this is the last one
+func (c *Client) ListTuplesByObjectPagination(object, cursor string, pageSize int) ([]ACLTuple, string, error) {
+	return c.listPage(encodeKey(primaryPrefix, object), cursor, pageSize, func(key, value []byte) (*ACLTuple, error) {
+		var tuple ACLTuple
+		if err := json.Unmarshal(value, &tuple); err != nil {
+			return nil, nil // Skip malformed entries
+		}
+		return &tuple, nil
+	})
 }
 
-// ListTuplesByUserAndRelation returns all tuples for a specific user and relation (USING REVERSE INDEX)
-func (c *Client) ListTuplesByUserAndRelation(user, relation string) ([]ACLTuple, error) {
-	// This is much more efficient with reverse index
-	prefix := user + "@"
-	iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
-	defer iter.Release()
+// ListTuplesByUserPagination returns a page of at most pageSize tuples for a
+// specific user (USING REVERSE INDEX), starting after cursor, and the cursor
+// of the next page, or "" if this is the last one
+func (c *Client) ListTuplesByUserPagination(user, cursor string, pageSize int) ([]ACLTuple, string, error) {
+	return c.listPage(encodeKey(reversePrefix, user), cursor, pageSize, func(key, _ []byte) (*ACLTuple, error) {
+		entry, err := c.parseReverseKey(key)
+		if err != nil {
+			return nil, nil // Skip malformed entries
+		}
+		// Get the actual tuple using primary key
+		return c.GetTuple(entry.Object, entry.Relation, entry.User)
+	})
+}
 
+// listPage reads a page of the index entries under prefix into a slice
+func (c *Client) listPage(prefix []byte, cursor string, pageSize int, read func(key, value []byte) (*ACLTuple, error)) ([]ACLTuple, string, error) {
 	var tuples []ACLTuple
-	for iter.Next() {
-		// Parse the reverse key to get object and relation
-		object, rel, parsedUser, err := c.parseReverseKey(string(iter.Key()))
-		if err != nil || rel != relation {
-			continue // Skip if relation doesn't match or malformed
-		}
+	next, err := c.scanPage(prefix, cursor, pageSize, read, func(tuple ACLTuple) error {
+		tuples = append(tuples, tuple)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return tuples, next, nil
+}
 
-		// Get the actual tuple using primary key
-		tuple, err := c.GetTuple(object, relation, parsedUser)
-		if err != nil || tuple == nil {
-			continue // Skip if tuple not found
-		}
+// scanPage passes a page of the index entries under prefix to emit, seeking
+// directly past the key encoded in cursor, and returns the cursor of the
+// next page. The cursor must lie under prefix, so it cannot be used to read
+// past the listing it was returned by. read returns nil for entries that
+// are skipped.
+func (c *Client) scanPage(prefix []byte, cursor string, pageSize int, read func(key, value []byte) (*ACLTuple, error), emit func(ACLTuple) error) (string, error) {
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return "", err
+	}
 
-		tuples = append(tuples, *tuple)
+	scan := util.BytesPrefix(prefix)
+	if after != nil {
+		if !bytes.HasPrefix(after, prefix) {
+			return "", ErrInvalidCursor
+		}
+		// The smallest key after the cursor
+		scan.Start = append(after, 0)
 	}
 
-	return tuples, iter.Error()
-}
+	v, err := c.newView()
+	if err != nil {
+		return "", err
+	}
+	defer v.release()
 
-// MigrateExistingData adds reverse indexes for existing data (one-time operation)
-func (c *Client) MigrateExistingData() error {
-	iter := c.db.NewIterator(util.BytesPrefix([]byte("")), nil)
+	iter, err := v.newIterator(prefix, scan)
+	if err != nil {
+		return "", err
+	}
 	defer iter.Release()
 
-	batch := new(leveldb.Batch)
-	batchSize := 0
-	const maxBatchSize = 1000
-
+	emitted := 0
+	var last []byte
 	for iter.Next() {
-		key := string(iter.Key())
-
-		// Skip if it's already a reverse index key
-		if strings.Contains(key, "@") && strings.Index(key, "@") < strings.Index(key, "#") {
+		tuple, err := read(iter.Key(), iter.Value())
+		if err != nil {
+			return "", err
+		}
+		if tuple == nil {
 			continue
 		}
-
-		// Parse the primary key
-		object, relation, user, err := c.parseTupleKey(key)
-		if err != nil {
-			continue // Skip malformed keys
+		if emitted == pageSize {
+			// Another tuple follows, so the page is not the last one
+			return EncodeCursor(last), nil
 		}
 
-		// Create reverse index
-		reverseKey := c.formatReverseKey(ACLTuple{Object: object, Relation: relation, User: user})
-		batch.Put([]byte(reverseKey), []byte{})
-
-		batchSize++
-		if batchSize >= maxBatchSize {
-			if err := c.db.Write(batch, nil); err != nil {
-				return fmt.Errorf("failed to write batch: %w", err)
-			}
-			batch = new(leveldb.Batch)
-			batchSize = 0
+		if err := emit(*tuple); err != nil {
+			return "", err
 		}
+		emitted++
+		last = append(last[:0], iter.Key()...)
 	}
+	return "", iter.Error()
+}
 
-	// Write remaining batch
-	if batchSize > 0 {
-		if err := c.db.Write(batch, nil); err != nil {
-			return fmt.Errorf("failed to write final batch: %w", err)
-		}
+// ListTuplesByUserAndRelation returns all tuples for a specific user and relation (USING RELATION INDEX)
+func (c *Client) ListTuplesByUserAndRelation(user, relation string) ([]ACLTuple, error) {
+	v, err := c.newView()
+	if err != nil {
+		return nil, err
 	}
+	defer v.release()
 
-	return iter.Error()
+	prefix := encodeKey(relationPrefix, user, relation)
+	iter, err := v.newIterator(prefix, util.BytesPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+
+	// The key holds the whole tuple, so no primary lookup is needed
+	var tuples []ACLTuple
+	for iter.Next() {
+		tuple, err := c.parseRelationKey(iter.Key())
+		if err != nil {
+			continue // Skip malformed entries
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, iter.Error()
 }
@@ -0,0 +1,214 @@
+package leveldb_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	goleveldb "github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/leveldb"
+	"mini-zanzibar/internal/database/storetest"
+)
+
+func TestTupleStoreConformance(t *testing.T) {
+	storetest.RunTupleStoreTests(t, func(t *testing.T) database.TupleStore {
+		client, err := leveldb.NewClient(filepath.Join(t.TempDir(), "leveldb"))
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	})
+}
+
+func TestRevisionSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leveldb")
+
+	client, err := leveldb.NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := client.StoreTuple(leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}); err != nil {
+		t.Fatalf("StoreTuple: %v", err)
+	}
+	want, _ := client.Revision()
+	client.Close()
+
+	client, err = leveldb.NewClient(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer client.Close()
+
+	if got, _ := client.Revision(); got != want {
+		t.Errorf("Revision after reopen = %d, want %d", got, want)
+	}
+}
+
+func TestRelationIndexBackfillsExistingTuples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leveldb")
+
+	// A database written before the relation index existed
+	db, err := goleveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	tuple := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+	value, _ := json.Marshal(tuple)
+	if err := db.Put([]byte("doc:readme#viewer@user:alice"), value, nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := db.Put([]byte("user:alice@doc:readme#viewer"), []byte{}, nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	db.Close()
+
+	client, err := leveldb.NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	tuples, err := client.ListTuplesByUserAndRelation(tuple.User, tuple.Relation)
+	if err != nil || !reflect.DeepEqual(tuples, []leveldb.ACLTuple{tuple}) {
+		t.Errorf("ListTuplesByUserAndRelation = %v, %v, want %v", tuples, err, tuple)
+	}
+}
+
+func TestHistoryBackfillsExistingTuples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leveldb")
+
+	// A database written before tuple history was kept
+	db, err := goleveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	tuple := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+	value, _ := json.Marshal(tuple)
+	if err := db.Put([]byte("doc:readme#viewer@user:alice"), value, nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	db.Close()
+
+	client, err := leveldb.NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	revision, _ := client.Revision()
+	snapshot, err := client.Snapshot(revision)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if found, err := snapshot.CheckTuple(tuple.Object, tuple.Relation, tuple.User); err != nil || !found {
+		t.Errorf("CheckTuple on snapshot = %v, %v, want true", found, err)
+	}
+}
+
+func TestRelationHistoryBackfillsExistingVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leveldb")
+
+	client, err := leveldb.NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	tuple := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+	if err := client.StoreTuple(tuple); err != nil {
+		t.Fatalf("StoreTuple: %v", err)
+	}
+	revision, _ := client.Revision()
+	client.Close()
+
+	// A database whose history was kept before the relation index history
+	db, err := goleveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	batch := new(goleveldb.Batch)
+	iter := db.NewIterator(util.BytesPrefix([]byte("\x02v")), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	batch.Delete([]byte("\x00relation-history"))
+	if err := db.Write(batch, nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	db.Close()
+
+	client, err = leveldb.NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	snapshot, err := client.Snapshot(revision)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	tuples, err := snapshot.ListTuplesByUserAndRelation(tuple.User, tuple.Relation)
+	if err != nil || !reflect.DeepEqual(tuples, []leveldb.ACLTuple{tuple}) {
+		t.Errorf("ListTuplesByUserAndRelation on snapshot = %v, %v, want %v", tuples, err, tuple)
+	}
+}
+
+func TestMigrateStringLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leveldb")
+
+	// A database written with the string key layout. The reverse entry of
+	// the group membership shares its prefix with the primary entries of
+	// the userset group:eng#member.
+	db, err := goleveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	viewer := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "group:eng#member"}
+	member := leveldb.ACLTuple{Object: "group:eng", Relation: "member", User: "user:alice"}
+	for _, tuple := range []leveldb.ACLTuple{viewer, member} {
+		value, _ := json.Marshal(tuple)
+		db.Put([]byte(tuple.Object+"#"+tuple.Relation+"@"+tuple.User), value, nil)
+		db.Put([]byte(tuple.User+"@"+tuple.Object+"#"+tuple.Relation), []byte{}, nil)
+	}
+	db.Close()
+
+	client, err := leveldb.NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	assertTuples := func(name string, got []leveldb.ACLTuple, err error, want ...leveldb.ACLTuple) {
+		t.Helper()
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	tuples, err := client.ListTuplesByObject("group:eng")
+	assertTuples("ListTuplesByObject", tuples, err, member)
+	tuples, err = client.ListTuplesByUser("group:eng#member")
+	assertTuples("ListTuplesByUser", tuples, err, viewer)
+	tuples, err = client.ListTuplesByUser("user:alice")
+	assertTuples("ListTuplesByUser", tuples, err, member)
+	if err := client.WaitForMigration(); err != nil {
+		t.Fatalf("WaitForMigration: %v", err)
+	}
+	client.Close()
+
+	// Only metadata and current layout keys are left
+	db, err = goleveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer db.Close()
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if key := iter.Key(); key[0] != 0 && key[0] != 2 {
+			t.Errorf("string layout key %q left after migration", key)
+		}
+	}
+}
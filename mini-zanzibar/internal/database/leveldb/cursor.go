@@ -0,0 +1,29 @@
+package leveldb
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// ErrInvalidCursor is returned for continuation tokens that cannot be
+// decoded or do not belong to the listing they are passed to
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor turns the key of the last tuple of a page into an opaque
+// continuation token
+func EncodeCursor(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// DecodeCursor returns the key encoded in a continuation token, or nil for
+// the empty token of the first page
+func DecodeCursor(cursor string) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
@@ -0,0 +1,492 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Every write also records the new version of the tuple under a history key
+// suffixed with the revision that committed it, so reads can be evaluated at
+// any retained revision.
+const (
+	// commitPrefix maps every revision to the time it was committed
+	commitPrefix = "\x00c/"
+)
+
+var (
+	// revisionKey holds the revision of the last committed write
+	revisionKey = []byte("\x00revision")
+	// oldestKey holds the oldest revision whose versions are retained
+	oldestKey = []byte("\x00oldest")
+	// historyMarkerKey is set once the history holds every stored tuple
+	historyMarkerKey = []byte("\x00history")
+	// relationHistoryMarkerKey is set once the relation index history holds
+	// every version of the reverse index history
+	relationHistoryMarkerKey = []byte("\x00relation-history")
+)
+
+var (
+	// ErrSnapshotExpired is returned for snapshots of revisions whose tuple
+	// versions have been garbage collected
+	ErrSnapshotExpired = errors.New("revision is older than the retained history")
+	// ErrFutureRevision is returned for snapshots of revisions that have not
+	// been committed yet
+	ErrFutureRevision = errors.New("revision has not been committed yet")
+)
+
+// gcBatchSize bounds the number of deletions written per garbage collection batch
+const gcBatchSize = 1000
+
+// encodeRevision encodes a revision so keys sort in revision order
+func encodeRevision(revision uint64) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, revision)
+	return value
+}
+
+// readRevision reads a revision stored under key, or zero if it is not set
+func readRevision(db *leveldb.DB, key []byte) (uint64, error) {
+	value, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, fmt.Errorf("invalid revision value under %q", key)
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// objectHistoryKey formats the key of the primary index version of tuple
+// committed at revision
+func objectHistoryKey(tuple ACLTuple, revision uint64) []byte {
+	return append(encodeKey(objectHistoryPrefix, tuple.Object, tuple.Relation, tuple.User), encodeRevision(revision)...)
+}
+
+// userHistoryKey formats the key of the reverse index version of tuple
+// committed at revision
+func userHistoryKey(tuple ACLTuple, revision uint64) []byte {
+	return append(encodeKey(userHistoryPrefix, tuple.User, tuple.Object, tuple.Relation), encodeRevision(revision)...)
+}
+
+// relationHistoryKey formats the key of the relation index version of tuple
+// committed at revision
+func relationHistoryKey(tuple ACLTuple, revision uint64) []byte {
+	return append(encodeKey(relationHistoryPrefix, tuple.User, tuple.Relation, tuple.Object), encodeRevision(revision)...)
+}
+
+// splitHistoryKey returns the index entry and the revision of a history key
+func splitHistoryKey(key []byte) (entry []byte, revision uint64, ok bool) {
+	if len(key) < 8 {
+		return nil, 0, false
+	}
+	return key[:len(key)-8], binary.BigEndian.Uint64(key[len(key)-8:]), true
+}
+
+// commitKey formats the key holding the commit time of revision
+func commitKey(revision uint64) []byte {
+	return append([]byte(commitPrefix), encodeRevision(revision)...)
+}
+
+// ensureHistory records the tuples stored before history was kept as
+// versions of the current revision. Older revisions cannot be
+// reconstructed, so they become unavailable to snapshots.
+func (c *Client) ensureHistory() error {
+	if _, err := c.db.Get(historyMarkerKey, nil); err == nil {
+		return nil
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+
+	// Tuples still in the string layout are versioned too
+	v, err := c.newView()
+	if err != nil {
+		return err
+	}
+	defer v.release()
+
+	iter, err := v.newIterator([]byte(primaryPrefix), util.BytesPrefix([]byte(primaryPrefix)))
+	if err != nil {
+		return err
+	}
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		var tuple ACLTuple
+		if err := json.Unmarshal(iter.Value(), &tuple); err != nil {
+			continue // Skip malformed entries
+		}
+
+		value := append([]byte{}, iter.Value()...)
+		batch.Put(objectHistoryKey(tuple, c.revision), value)
+		batch.Put(userHistoryKey(tuple, c.revision), value)
+		batch.Put(relationHistoryKey(tuple, c.revision), value)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	c.oldest = c.revision
+	batch.Put(oldestKey, encodeRevision(c.oldest))
+	batch.Put(historyMarkerKey, []byte{1})
+	batch.Put(relationHistoryMarkerKey, []byte{1})
+	return c.db.Write(batch, nil)
+}
+
+// ensureRelationHistory adds the relation index history of tuple versions
+// recorded before it was kept, copied from the reverse index history, which
+// holds the same versions. Rewriting a version is harmless, so an
+// interrupted run simply starts over.
+func (c *Client) ensureRelationHistory() error {
+	if _, err := c.db.Get(relationHistoryMarkerKey, nil); err == nil {
+		return nil
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+
+	iter := c.db.NewIterator(util.BytesPrefix([]byte(userHistoryPrefix)), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		entry, revision, ok := splitHistoryKey(iter.Key())
+		if !ok {
+			continue // Skip malformed keys
+		}
+		tuple, err := c.parseReverseHistoryEntry(entry)
+		if err != nil {
+			continue // Skip malformed keys
+		}
+		batch.Put(relationHistoryKey(tuple, revision), append([]byte{}, iter.Value()...))
+
+		if batch.Len() >= migrateBatchSize {
+			if err := c.db.Write(batch, nil); err != nil {
+				return fmt.Errorf("failed to write batch: %w", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	batch.Put(relationHistoryMarkerKey, []byte{1})
+	return c.db.Write(batch, nil)
+}
+
+// parseReverseHistoryEntry parses the reverse index history entry of a
+// version, i.e. its key without the revision
+func (c *Client) parseReverseHistoryEntry(entry []byte) (ACLTuple, error) {
+	components, err := decodeKey(entry, userHistoryPrefix, 3)
+	if err != nil {
+		return ACLTuple{}, err
+	}
+	return ACLTuple{User: components[0], Object: components[1], Relation: components[2]}, nil
+}
+
+// Snapshot returns a reader of the tuples as they were at revision
+func (c *Client) Snapshot(revision uint64) (TupleReader, error) {
+	if err := c.checkSnapshot(revision); err != nil {
+		return nil, err
+	}
+	return &Snapshot{client: c, revision: revision}, nil
+}
+
+// checkSnapshot reports whether revision can still be read
+func (c *Client) checkSnapshot(revision uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if revision > c.revision {
+		return ErrFutureRevision
+	}
+	if revision < c.oldest {
+		return ErrSnapshotExpired
+	}
+	return nil
+}
+
+// GarbageCollect removes the tuple versions that are only visible to
+// revisions committed more than retention ago, and the changelog up to the
+// new oldest revision. For every tuple the version visible at the oldest
+// revision is kept unless it is a deletion. It returns the number of
+// versions removed.
+func (c *Client) GarbageCollect(retention time.Duration) (int, error) {
+	// Versions still in the string layout are not collected, so collection
+	// waits for the migration; otherwise an older version could outlive a
+	// newer one and reappear in snapshots
+	if c.migrating.Load() {
+		return 0, nil
+	}
+
+	oldest, err := c.revisionBefore(time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	if oldest <= c.oldest {
+		c.mu.Unlock()
+		return 0, nil
+	}
+	// Advance the oldest revision first, so snapshots that would read
+	// versions about to be removed fail instead
+	if err := c.db.Put(oldestKey, encodeRevision(oldest), nil); err != nil {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("failed to store oldest revision: %w", err)
+	}
+	c.oldest = oldest
+	c.mu.Unlock()
+
+	removed, err := c.collectHistory(objectHistoryPrefix, oldest)
+	if err != nil {
+		return 0, err
+	}
+	for _, prefix := range []string{userHistoryPrefix, relationHistoryPrefix} {
+		if _, err := c.collectHistory(prefix, oldest); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := c.deleteRange(util.BytesPrefix([]byte(commitPrefix)).Start, commitKey(oldest)); err != nil {
+		return 0, err
+	}
+	// Changes up to oldest are no longer needed to catch up from a retained revision
+	if err := c.deleteRange(changelogKey(0), changelogKey(oldest+1)); err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// revisionBefore returns the newest revision committed at or before cutoff
+func (c *Client) revisionBefore(cutoff time.Time) (uint64, error) {
+	iter := c.db.NewIterator(util.BytesPrefix([]byte(commitPrefix)), nil)
+	defer iter.Release()
+
+	var revision uint64
+	for iter.Next() {
+		if len(iter.Value()) != 8 {
+			continue
+		}
+		committed := time.Unix(0, int64(binary.BigEndian.Uint64(iter.Value())))
+		if committed.After(cutoff) {
+			break
+		}
+		revision = binary.BigEndian.Uint64(iter.Key()[len(commitPrefix):])
+	}
+	return revision, iter.Error()
+}
+
+// collectHistory removes the versions under prefix that no revision from
+// oldest on can see and returns how many were removed
+func (c *Client) collectHistory(prefix string, oldest uint64) (int, error) {
+	iter := c.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	removed := 0
+
+	// Versions of an entry are adjacent and ordered by revision. The last
+	// version at or before oldest is pending until the next key shows
+	// whether it is superseded; deletions are dropped in any case.
+	var pendingEntry, pendingKey []byte
+	var pendingDeleted bool
+	drop := func(key []byte) error {
+		batch.Delete(key)
+		removed++
+		if batch.Len() < gcBatchSize {
+			return nil
+		}
+		if err := c.db.Write(batch, nil); err != nil {
+			return fmt.Errorf("failed to write batch: %w", err)
+		}
+		batch.Reset()
+		return nil
+	}
+
+	for iter.Next() {
+		entry, revision, ok := splitHistoryKey(iter.Key())
+		if !ok {
+			continue // Skip malformed keys
+		}
+
+		if pendingKey != nil {
+			superseded := revision <= oldest && bytes.Equal(entry, pendingEntry)
+			if superseded || pendingDeleted {
+				if err := drop(pendingKey); err != nil {
+					return 0, err
+				}
+			}
+			pendingKey = nil
+		}
+
+		if revision <= oldest {
+			pendingEntry = append(pendingEntry[:0], entry...)
+			pendingKey = append([]byte{}, iter.Key()...)
+			pendingDeleted = len(iter.Value()) == 0
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	if pendingKey != nil && pendingDeleted {
+		batch.Delete(pendingKey)
+		removed++
+	}
+	if err := c.db.Write(batch, nil); err != nil {
+		return 0, fmt.Errorf("failed to write batch: %w", err)
+	}
+
+	return removed, nil
+}
+
+// deleteRange deletes all keys in [start, limit)
+func (c *Client) deleteRange(start, limit []byte) error {
+	iter := c.db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+		if batch.Len() >= gcBatchSize {
+			if err := c.db.Write(batch, nil); err != nil {
+				return fmt.Errorf("failed to write batch: %w", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return c.db.Write(batch, nil)
+}
+
+// Snapshot reads the tuples as they were at a fixed revision
+type Snapshot struct {
+	client   *Client
+	revision uint64
+}
+
+// Revision returns the revision the snapshot reads at
+func (s *Snapshot) Revision() uint64 {
+	return s.revision
+}
+
+// GetTuple retrieves a specific ACL tuple as of the snapshot revision
+func (s *Snapshot) GetTuple(object, relation, user string) (*ACLTuple, error) {
+	tuple := ACLTuple{Object: object, Relation: relation, User: user}
+	tuples, err := s.scan(encodeKey(objectHistoryPrefix, object, relation, user), func(t ACLTuple) bool {
+		return t == tuple
+	})
+	if err != nil || len(tuples) == 0 {
+		return nil, err
+	}
+	return &tuples[0], nil
+}
+
+// CheckTuple checks if a specific tuple existed at the snapshot revision
+func (s *Snapshot) CheckTuple(object, relation, user string) (bool, error) {
+	tuple, err := s.GetTuple(object, relation, user)
+	if err != nil {
+		return false, err
+	}
+	return tuple != nil, nil
+}
+
+// ListTuplesByObject returns all tuples for a specific object
+func (s *Snapshot) ListTuplesByObject(object string) ([]ACLTuple, error) {
+	return s.scan(encodeKey(objectHistoryPrefix, object), func(t ACLTuple) bool {
+		return t.Object == object
+	})
+}
+
+// ListTuplesByObjectAndRelation returns all tuples for a specific object and relation
+func (s *Snapshot) ListTuplesByObjectAndRelation(object, relation string) ([]ACLTuple, error) {
+	return s.scan(encodeKey(objectHistoryPrefix, object, relation), func(t ACLTuple) bool {
+		return t.Object == object && t.Relation == relation
+	})
+}
+
+// ListTuplesByUser returns all tuples for a specific user
+func (s *Snapshot) ListTuplesByUser(user string) ([]ACLTuple, error) {
+	return s.scan(encodeKey(userHistoryPrefix, user), func(t ACLTuple) bool {
+		return t.User == user
+	})
+}
+
+// ListTuplesByUserAndRelation returns all tuples for a specific user and
+// relation, using the relation index history
+func (s *Snapshot) ListTuplesByUserAndRelation(user, relation string) ([]ACLTuple, error) {
+	return s.scan(encodeKey(relationHistoryPrefix, user, relation), func(t ACLTuple) bool {
+		return t.User == user && t.Relation == relation
+	})
+}
+
+// scan returns the matching tuples whose history entries under prefix were
+// present at the snapshot revision, in index order
+func (s *Snapshot) scan(prefix []byte, match func(ACLTuple) bool) ([]ACLTuple, error) {
+	v, err := s.client.newView()
+	if err != nil {
+		return nil, err
+	}
+	defer v.release()
+
+	iter, err := v.newIterator(prefix, util.BytesPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+
+	var tuples []ACLTuple
+	var entry, visible []byte
+	emit := func() {
+		if len(visible) == 0 {
+			return
+		}
+		var tuple ACLTuple
+		if err := json.Unmarshal(visible, &tuple); err != nil {
+			return // Skip malformed entries
+		}
+		if match(tuple) {
+			tuples = append(tuples, tuple)
+		}
+	}
+
+	for iter.Next() {
+		key, revision, ok := splitHistoryKey(iter.Key())
+		if !ok {
+			continue // Skip malformed keys
+		}
+		if !bytes.Equal(key, entry) {
+			emit()
+			entry = append(entry[:0], key...)
+			visible = nil
+		}
+		if revision <= s.revision {
+			visible = append(visible[:0], iter.Value()...)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	emit()
+
+	// Garbage collection may have removed versions while scanning
+	if err := s.client.checkSnapshot(s.revision); err != nil {
+		return nil, err
+	}
+
+	return tuples, nil
+}
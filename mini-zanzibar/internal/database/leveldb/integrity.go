@@ -0,0 +1,252 @@
+package leveldb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Kinds of integrity issues
+const (
+	// IssueDanglingReverse is a reverse entry without its primary entry
+	IssueDanglingReverse = "dangling_reverse"
+	// IssueMissingReverse is a primary entry without its reverse entry
+	IssueMissingReverse = "missing_reverse"
+	// IssueDanglingRelation is a relation index entry without its primary entry
+	IssueDanglingRelation = "dangling_relation"
+	// IssueMissingRelation is a primary entry without its relation index entry
+	IssueMissingRelation = "missing_relation"
+	// IssueMalformed is an index entry whose key cannot be decoded, or a
+	// primary entry whose value does not hold the tuple of its key
+	IssueMalformed = "malformed"
+)
+
+const (
+	// maxReportedIssues bounds the issues listed in a report; all of them
+	// are still counted and repaired
+	maxReportedIssues = 1000
+	// repairBatchSize bounds the number of fixes written per batch
+	repairBatchSize = 1000
+)
+
+// IntegrityIssue is a single inconsistency between the primary index and
+// the reverse or relation index. Key is the entry at fault: the one found
+// for dangling and malformed entries, the one expected for missing entries.
+type IntegrityIssue struct {
+	Kind   string    `json:"kind"`
+	Key    string    `json:"key"`
+	Tuple  *ACLTuple `json:"tuple,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// IntegrityReport is the result of CheckIntegrity
+type IntegrityReport struct {
+	PrimaryEntries  int              `json:"primary_entries"`
+	ReverseEntries  int              `json:"reverse_entries"`
+	RelationEntries int              `json:"relation_entries"`
+	IssueCounts     map[string]int   `json:"issue_counts"`
+	Issues          []IntegrityIssue `json:"issues"`
+	// Truncated is set if more issues were found than are listed
+	Truncated bool `json:"truncated,omitempty"`
+	// Repaired is the number of issues fixed
+	Repaired int `json:"repaired"`
+}
+
+// TotalIssues returns the number of issues found
+func (r *IntegrityReport) TotalIssues() int {
+	total := 0
+	for _, count := range r.IssueCounts {
+		total += count
+	}
+	return total
+}
+
+func (r *IntegrityReport) add(issue IntegrityIssue) {
+	r.IssueCounts[issue.Kind]++
+	if len(r.Issues) < maxReportedIssues {
+		r.Issues = append(r.Issues, issue)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// dbReader is the read side shared by the database and its snapshots
+type dbReader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+// CheckIntegrity verifies that every primary entry has its reverse and
+// relation index entry and every such entry its primary entry, and that all
+// entries can be decoded. Without repair it reads a consistent snapshot
+// while writes go on. With repair, writes are blocked until it finishes, and
+// missing entries are added, dangling and undecodable entries removed, and
+// primary values rewritten from their key, in batches.
+//
+// Repairs commit no revision and write neither history nor changelog. The
+// primary keys define the stored tuples and the history was written with
+// them, so a repair only makes the live indexes agree with tuples watchers
+// and snapshots have already seen; there is no tuple change to report.
+func (c *Client) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	var reader dbReader
+	if repair {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		reader = c.db
+	} else {
+		snapshot, err := c.db.GetSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		defer snapshot.Release()
+		reader = snapshot
+	}
+
+	report := &IntegrityReport{
+		IssueCounts: make(map[string]int),
+		Issues:      []IntegrityIssue{},
+	}
+	fixes := &repairBatch{client: c, enabled: repair, report: report}
+
+	if err := c.checkPrimaryIndex(reader, report, fixes); err != nil {
+		return nil, err
+	}
+	// Write the added entries before the other indexes are read
+	if err := fixes.flush(); err != nil {
+		return nil, err
+	}
+	if err := c.checkUserIndex(reader, reversePrefix, c.parseReverseKey, IssueDanglingReverse, &report.ReverseEntries, report, fixes); err != nil {
+		return nil, err
+	}
+	if err := c.checkUserIndex(reader, relationPrefix, c.parseRelationKey, IssueDanglingRelation, &report.RelationEntries, report, fixes); err != nil {
+		return nil, err
+	}
+	if err := fixes.flush(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// checkPrimaryIndex checks every primary entry
+func (c *Client) checkPrimaryIndex(reader dbReader, report *IntegrityReport, fixes *repairBatch) error {
+	iter := reader.NewIterator(util.BytesPrefix([]byte(primaryPrefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		report.PrimaryEntries++
+		key := append([]byte{}, iter.Key()...)
+
+		tuple, err := c.parseTupleKey(key)
+		if err != nil {
+			report.add(IntegrityIssue{Kind: IssueMalformed, Key: fmt.Sprintf("%q", key), Detail: err.Error()})
+			fixes.delete(key)
+			continue
+		}
+
+		var stored ACLTuple
+		if err := json.Unmarshal(iter.Value(), &stored); err != nil || stored != tuple {
+			report.add(IntegrityIssue{Kind: IssueMalformed, Key: fmt.Sprintf("%q", key), Tuple: &tuple, Detail: "value does not hold the tuple of the key"})
+			value, err := json.Marshal(tuple)
+			if err != nil {
+				return fmt.Errorf("failed to marshal tuple: %w", err)
+			}
+			fixes.put(key, value)
+		}
+
+		for _, index := range []struct {
+			key     []byte
+			missing string
+		}{
+			{c.formatReverseKey(tuple), IssueMissingReverse},
+			{c.formatRelationKey(tuple), IssueMissingRelation},
+		} {
+			if _, err := reader.Get(index.key, nil); err == leveldb.ErrNotFound {
+				report.add(IntegrityIssue{Kind: index.missing, Key: fmt.Sprintf("%q", index.key), Tuple: &tuple})
+				fixes.put(index.key, []byte{})
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if err := fixes.flushIfFull(); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// checkUserIndex checks every entry of the reverse or the relation index,
+// counting them in entries
+func (c *Client) checkUserIndex(reader dbReader, prefix string, parse func([]byte) (ACLTuple, error), dangling string, entries *int, report *IntegrityReport, fixes *repairBatch) error {
+	iter := reader.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		*entries++
+		key := append([]byte{}, iter.Key()...)
+
+		tuple, err := parse(key)
+		if err != nil {
+			report.add(IntegrityIssue{Kind: IssueMalformed, Key: fmt.Sprintf("%q", key), Detail: err.Error()})
+			fixes.delete(key)
+			continue
+		}
+
+		if _, err := reader.Get(c.formatTupleKey(tuple), nil); err == leveldb.ErrNotFound {
+			report.add(IntegrityIssue{Kind: dangling, Key: fmt.Sprintf("%q", key), Tuple: &tuple})
+			fixes.delete(key)
+		} else if err != nil {
+			return err
+		}
+
+		if err := fixes.flushIfFull(); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// repairBatch collects the fixes of CheckIntegrity and writes them in
+// batches if repairing is enabled
+type repairBatch struct {
+	client  *Client
+	enabled bool
+	report  *IntegrityReport
+	batch   leveldb.Batch
+}
+
+func (b *repairBatch) put(key, value []byte) {
+	if b.enabled {
+		b.batch.Put(key, value)
+	}
+}
+
+func (b *repairBatch) delete(key []byte) {
+	if b.enabled {
+		b.batch.Delete(key)
+	}
+}
+
+func (b *repairBatch) flushIfFull() error {
+	if b.batch.Len() < repairBatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+func (b *repairBatch) flush() error {
+	if b.batch.Len() == 0 {
+		return nil
+	}
+	if err := b.client.db.Write(&b.batch, nil); err != nil {
+		return fmt.Errorf("failed to write repair batch: %w", err)
+	}
+	b.report.Repaired += b.batch.Len()
+	b.batch.Reset()
+	return nil
+}
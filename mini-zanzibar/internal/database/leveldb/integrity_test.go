@@ -0,0 +1,86 @@
+package leveldb
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	client, err := NewClient(filepath.Join(t.TempDir(), "leveldb"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	intact := ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+	unindexed := ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:bob"}
+	deleted := ACLTuple{Object: "doc:report", Relation: "owner", User: "user:carol"}
+	for _, tuple := range []ACLTuple{intact, unindexed, deleted} {
+		if err := client.StoreTuple(tuple); err != nil {
+			t.Fatalf("StoreTuple: %v", err)
+		}
+	}
+
+	// Corrupt the indexes behind the client's back
+	client.db.Delete(client.formatReverseKey(unindexed), nil)
+	client.db.Delete(client.formatRelationKey(unindexed), nil)
+	client.db.Delete(client.formatTupleKey(deleted), nil)
+	client.db.Put([]byte(reversePrefix+"garbage"), []byte{}, nil)
+
+	want := map[string]int{
+		IssueMissingReverse:   1,
+		IssueMissingRelation:  1,
+		IssueDanglingReverse:  1,
+		IssueDanglingRelation: 1,
+		IssueMalformed:        1,
+	}
+
+	report, err := client.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("CheckIntegrity: %v", err)
+	}
+	if !equalCounts(report.IssueCounts, want) || report.Repaired != 0 {
+		t.Errorf("CheckIntegrity = %v, repaired %d, want %v, repaired 0", report.IssueCounts, report.Repaired, want)
+	}
+	for _, issue := range report.Issues {
+		if issue.Kind == IssueMissingReverse && issue.Key != fmt.Sprintf("%q", client.formatReverseKey(unindexed)) {
+			t.Errorf("missing reverse issue key = %s, want the missing reverse key", issue.Key)
+		}
+	}
+
+	report, err = client.CheckIntegrity(true)
+	if err != nil {
+		t.Fatalf("CheckIntegrity with repair: %v", err)
+	}
+	if !equalCounts(report.IssueCounts, want) || report.Repaired != 5 {
+		t.Errorf("CheckIntegrity with repair = %v, repaired %d, want %v, repaired 5", report.IssueCounts, report.Repaired, want)
+	}
+
+	report, err = client.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("CheckIntegrity after repair: %v", err)
+	}
+	if report.TotalIssues() != 0 || report.PrimaryEntries != 2 || report.ReverseEntries != 2 || report.RelationEntries != 2 {
+		t.Errorf("CheckIntegrity after repair = %+v, want 2 clean entries per index", report)
+	}
+
+	if tuples, _ := client.ListTuplesByUser("user:bob"); len(tuples) != 1 {
+		t.Errorf("ListTuplesByUser after repair = %v, want the unindexed tuple", tuples)
+	}
+	if tuples, _ := client.ListTuplesByUserAndRelation("user:bob", "viewer"); len(tuples) != 1 {
+		t.Errorf("ListTuplesByUserAndRelation after repair = %v, want the unindexed tuple", tuples)
+	}
+}
+
+func equalCounts(got, want map[string]int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for kind, count := range want {
+		if got[kind] != count {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Tuple keys are made of a prefix naming the layout version and the index,
+// followed by the tuple's components in index order. Every component is
+// escaped and terminated, so components may contain any byte, a key never
+// is a prefix of a key with different components, and keys sort by their
+// components in order. Metadata keys start with a NUL byte instead.
+const (
+	// layoutVersion is the version of the key layout written by this client
+	layoutVersion = 2
+
+	// primaryPrefix indexes tuples by object, relation and user; the value
+	// is the JSON tuple
+	primaryPrefix = "\x02p"
+	// reversePrefix indexes tuples by user, object and relation; the value
+	// is empty
+	reversePrefix = "\x02r"
+	// relationPrefix indexes tuples by user, relation and object, so a
+	// user's tuples of one relation are a single range; the value is empty
+	relationPrefix = "\x02s"
+	// objectHistoryPrefix, userHistoryPrefix and relationHistoryPrefix
+	// version the primary, the reverse and the relation index. Their keys
+	// are followed by the revision that committed the version, which holds
+	// the JSON tuple, or is empty if the tuple was deleted at that revision.
+	objectHistoryPrefix   = "\x02h"
+	userHistoryPrefix     = "\x02u"
+	relationHistoryPrefix = "\x02v"
+)
+
+var (
+	// layoutKey holds the version of the key layout the database was migrated to
+	layoutKey = []byte("\x00layout")
+	// relationIndexMarkerKey is set once the relation index holds every
+	// stored tuple
+	relationIndexMarkerKey = []byte("\x00relation-index")
+)
+
+const (
+	// componentEscape escapes a NUL byte within a component
+	componentEscape = 0xff
+	// componentEnd follows the NUL byte terminating a component
+	componentEnd = 0x01
+)
+
+// encodeKey formats a key from prefix and components
+func encodeKey(prefix string, components ...string) []byte {
+	key := []byte(prefix)
+	for _, component := range components {
+		key = appendComponent(key, component)
+	}
+	return key
+}
+
+// appendComponent appends a single escaped and terminated component
+func appendComponent(key []byte, component string) []byte {
+	for i := 0; i < len(component); i++ {
+		if component[i] == 0 {
+			key = append(key, 0, componentEscape)
+			continue
+		}
+		key = append(key, component[i])
+	}
+	return append(key, 0, componentEnd)
+}
+
+// decodeKey returns the n components of a key with the given prefix
+func decodeKey(key []byte, prefix string, n int) ([]string, error) {
+	if !bytes.HasPrefix(key, []byte(prefix)) {
+		return nil, fmt.Errorf("invalid key: missing prefix %q", prefix)
+	}
+	components, partial, err := decodeComponents(key[len(prefix):])
+	if err != nil {
+		return nil, err
+	}
+	if partial != "" || len(components) != n {
+		return nil, fmt.Errorf("invalid key: expected %d components, got %d", n, len(components))
+	}
+	return components, nil
+}
+
+// decodeComponents returns the terminated components of rest and the
+// unterminated component that follows them, if any
+func decodeComponents(rest []byte) ([]string, string, error) {
+	var components []string
+	var component []byte
+	for i := 0; i < len(rest); i++ {
+		if rest[i] != 0 {
+			component = append(component, rest[i])
+			continue
+		}
+		if i+1 == len(rest) {
+			return nil, "", fmt.Errorf("invalid key: truncated component")
+		}
+
+		i++
+		switch rest[i] {
+		case componentEscape:
+			component = append(component, 0)
+		case componentEnd:
+			components = append(components, string(component))
+			component = component[:0]
+		default:
+			return nil, "", fmt.Errorf("invalid key: bad escape 0x%02x", rest[i])
+		}
+	}
+	return components, string(component), nil
+}
+
+// EncodeComponents encodes components like the index keys, without a
+// prefix, so other backends can key and order tuples like the indexes do
+func EncodeComponents(components ...string) string {
+	return string(encodeKey("", components...))
+}
+
+// formatTupleKey formats the primary index key: object, relation, user
+func (c *Client) formatTupleKey(tuple ACLTuple) []byte {
+	return encodeKey(primaryPrefix, tuple.Object, tuple.Relation, tuple.User)
+}
+
+// formatReverseKey formats the reverse index key: user, object, relation
+func (c *Client) formatReverseKey(tuple ACLTuple) []byte {
+	return encodeKey(reversePrefix, tuple.User, tuple.Object, tuple.Relation)
+}
+
+// formatRelationKey formats the relation index key: user, relation, object
+func (c *Client) formatRelationKey(tuple ACLTuple) []byte {
+	return encodeKey(relationPrefix, tuple.User, tuple.Relation, tuple.Object)
+}
+
+// parseTupleKey parses a primary index key back into a tuple
+func (c *Client) parseTupleKey(key []byte) (ACLTuple, error) {
+	components, err := decodeKey(key, primaryPrefix, 3)
+	if err != nil {
+		return ACLTuple{}, err
+	}
+	return ACLTuple{Object: components[0], Relation: components[1], User: components[2]}, nil
+}
+
+// parseReverseKey parses a reverse index key back into a tuple
+func (c *Client) parseReverseKey(key []byte) (ACLTuple, error) {
+	components, err := decodeKey(key, reversePrefix, 3)
+	if err != nil {
+		return ACLTuple{}, err
+	}
+	return ACLTuple{Object: components[1], Relation: components[2], User: components[0]}, nil
+}
+
+// parseRelationKey parses a relation index key back into a tuple
+func (c *Client) parseRelationKey(key []byte) (ACLTuple, error) {
+	components, err := decodeKey(key, relationPrefix, 3)
+	if err != nil {
+		return ACLTuple{}, err
+	}
+	return ACLTuple{Object: components[2], Relation: components[1], User: components[0]}, nil
+}
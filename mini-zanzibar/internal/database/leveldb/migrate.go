@@ -0,0 +1,503 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// The string layout stored tuples under object#relation@user and reverse
+// entries under user@object#relation, both without a prefix, and their
+// history under these prefixes followed by the string key, a NUL byte and
+// the revision
+const (
+	stringObjectHistoryPrefix = "\x00h/"
+	stringUserHistoryPrefix   = "\x00u/"
+)
+
+// migrateBatchSize bounds the number of keys rewritten per migration batch
+const migrateBatchSize = 1000
+
+// stringDataStart is the first key of the string layout's tuple and reverse
+// entries. Metadata and the keys of the current layout sort before it.
+var stringDataStart = []byte{0x03}
+
+// stringLayoutRanges returns the key ranges of the string layout
+func stringLayoutRanges() []*util.Range {
+	return []*util.Range{
+		util.BytesPrefix([]byte(stringObjectHistoryPrefix)),
+		util.BytesPrefix([]byte(stringUserHistoryPrefix)),
+		{Start: stringDataStart},
+	}
+}
+
+// detectMigration marks a database that still holds string layout entries
+// as migrating. Any other database is marked as migrated right away.
+func (c *Client) detectMigration() error {
+	if layout, err := readRevision(c.db, layoutKey); err != nil || layout == layoutVersion {
+		return err
+	}
+
+	for _, r := range stringLayoutRanges() {
+		iter := c.db.NewIterator(r, nil)
+		found := iter.Next()
+		err := iter.Error()
+		iter.Release()
+		if err != nil {
+			return err
+		}
+		if found {
+			c.migrating.Store(true)
+			return nil
+		}
+	}
+	return c.db.Put(layoutKey, encodeRevision(layoutVersion), nil)
+}
+
+// Migrating reports whether the string key layout is still being migrated
+func (c *Client) Migrating() bool {
+	return c.migrating.Load()
+}
+
+// WaitForMigration waits until the background migration has finished or
+// was stopped by Close, and returns the error that ended it
+func (c *Client) WaitForMigration() error {
+	<-c.migrated
+	return c.migrationErr
+}
+
+// MigrateExistingData moves tuples and their history from the string key
+// layout to the current one. NewClient runs it in the background while the
+// client serves requests: until it finishes, reads merge both layouts and
+// writes remove the string layout entries of the tuples they change. Every
+// batch is written under the write lock and removes the entries it
+// rewrites, so reads see each tuple in exactly one layout, and a migration
+// stopped by Close or a crash continues at the next start. Primary entries
+// are recognised by their JSON value and their reverse entries are rebuilt
+// from them.
+func (c *Client) MigrateExistingData() error {
+	if !c.migrating.Load() {
+		return nil
+	}
+
+	for _, r := range stringLayoutRanges() {
+		for start := r.Start; start != nil; {
+			select {
+			case <-c.stop:
+				return nil
+			default:
+			}
+
+			var err error
+			if start, err = c.migrateBatch(&util.Range{Start: start, Limit: r.Limit}); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.db.Put(layoutKey, encodeRevision(layoutVersion), nil); err != nil {
+		return fmt.Errorf("failed to store key layout: %w", err)
+	}
+	c.migrating.Store(false)
+	return nil
+}
+
+// migrateBatch migrates the first migrateBatchSize entries in r and returns
+// the key to continue at, or nil once r is done
+func (c *Client) migrateBatch(r *util.Range) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	iter := c.db.NewIterator(r, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	var next []byte
+	for n := 0; iter.Next(); n++ {
+		if n == migrateBatchSize {
+			next = append([]byte{}, iter.Key()...)
+			break
+		}
+		if err := c.migrateEntry(batch, iter.Key(), iter.Value()); err != nil {
+			return nil, err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := c.db.Write(batch, nil); err != nil {
+		return nil, fmt.Errorf("failed to write batch: %w", err)
+	}
+	return next, nil
+}
+
+// migrateEntry rewrites a single string layout entry. Malformed entries are
+// left for inspection.
+func (c *Client) migrateEntry(batch *leveldb.Batch, key, value []byte) error {
+	key = append([]byte{}, key...)
+	value = append([]byte{}, value...)
+
+	switch {
+	case bytes.HasPrefix(key, []byte(stringObjectHistoryPrefix)):
+		if tuple, revision, ok := parseStringHistoryEntry(key, value); ok {
+			batch.Put(objectHistoryKey(tuple, revision), value)
+			batch.Delete(key)
+		}
+	case bytes.HasPrefix(key, []byte(stringUserHistoryPrefix)):
+		if tuple, revision, ok := parseStringHistoryEntry(key, value); ok {
+			batch.Put(userHistoryKey(tuple, revision), value)
+			batch.Put(relationHistoryKey(tuple, revision), value)
+			batch.Delete(key)
+		}
+	case len(value) == 0:
+		// A reverse entry is removed together with its primary entry, or
+		// right away if that is gone
+		tuple, err := parseStringReverseKey(string(key))
+		if err != nil {
+			return nil
+		}
+		if _, err := c.db.Get([]byte(stringTupleKey(tuple)), nil); err == leveldb.ErrNotFound {
+			batch.Delete(key)
+		} else if err != nil {
+			return err
+		}
+	default:
+		var tuple ACLTuple
+		if err := json.Unmarshal(value, &tuple); err != nil {
+			return nil
+		}
+		batch.Put(c.formatTupleKey(tuple), value)
+		batch.Put(c.formatReverseKey(tuple), []byte{})
+		batch.Put(c.formatRelationKey(tuple), []byte{})
+		batch.Delete(key)
+		batch.Delete([]byte(stringReverseKey(tuple)))
+	}
+	return nil
+}
+
+// view is a consistent read of the database. While the string layout is
+// migrated it reads a snapshot and merges the string layout entries into
+// every scan, converted to the current layout, so a tuple the migration
+// moves meanwhile is seen exactly once.
+type view struct {
+	client  *Client
+	reader  dbReader
+	merge   bool
+	release func()
+}
+
+// newView returns a view of the database, which must be released
+func (c *Client) newView() (*view, error) {
+	if !c.migrating.Load() {
+		return &view{client: c, reader: c.db, release: func() {}}, nil
+	}
+
+	snapshot, err := c.db.GetSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	return &view{client: c, reader: snapshot, merge: true, release: snapshot.Release}, nil
+}
+
+// newIterator iterates over the entries in r, which lies under prefix
+func (v *view) newIterator(prefix []byte, r *util.Range) (iterator.Iterator, error) {
+	iter := v.reader.NewIterator(r, nil)
+	if !v.merge {
+		return iter, nil
+	}
+
+	entries, err := v.client.stringLayoutEntries(v.reader, prefix)
+	if err != nil {
+		iter.Release()
+		return nil, err
+	}
+	return iterator.NewMergedIterator([]iterator.Iterator{iter, entries.NewIterator(r)}, comparer.DefaultComparer, true), nil
+}
+
+// getTuple returns the stored tuple, or nil if it is not stored
+func (v *view) getTuple(tuple ACLTuple) (*ACLTuple, error) {
+	value, err := v.reader.Get(v.client.formatTupleKey(tuple), nil)
+	if err == leveldb.ErrNotFound && v.merge {
+		value, err = v.reader.Get([]byte(stringTupleKey(tuple)), nil)
+	}
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tuple: %w", err)
+	}
+
+	var result ACLTuple
+	if err := json.Unmarshal(value, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tuple: %w", err)
+	}
+	return &result, nil
+}
+
+// stringLayoutEntries returns the string layout entries that belong under
+// prefix in the current layout, converted to it. The string layout is only
+// read where its keys start with the components of prefix; the converted
+// keys are then filtered by prefix itself.
+func (c *Client) stringLayoutEntries(reader dbReader, prefix []byte) (*memdb.DB, error) {
+	entries := memdb.New(comparer.DefaultComparer, 0)
+	if len(prefix) < 2 {
+		return entries, nil
+	}
+	components, partial, err := decodeComponents(prefix[2:])
+	if err != nil {
+		return entries, nil // No key of the current layout lies under prefix
+	}
+
+	add := func(key, value []byte) {
+		if bytes.HasPrefix(key, prefix) {
+			entries.Put(key, value)
+		}
+	}
+	// The string layout has no relation index, so relation index reads are
+	// narrowed by the user alone
+	user := partial
+	if len(components) > 0 {
+		user = components[0] + "@"
+	}
+
+	switch string(prefix[:2]) {
+	case primaryPrefix:
+		err = scanStringTuples(reader, stringKey(components, partial, "#", "@"), func(tuple ACLTuple, value []byte) {
+			add(c.formatTupleKey(tuple), value)
+		})
+	case reversePrefix:
+		err = scanStringReverse(reader, stringKey(components, partial, "@", "#"), func(tuple ACLTuple) {
+			add(c.formatReverseKey(tuple), []byte{})
+		})
+	case relationPrefix:
+		err = scanStringReverse(reader, user, func(tuple ACLTuple) {
+			add(c.formatRelationKey(tuple), []byte{})
+		})
+	case objectHistoryPrefix:
+		err = scanStringHistory(reader, stringObjectHistoryPrefix+stringKey(components, partial, "#", "@"), func(tuple ACLTuple, revision uint64, value []byte) {
+			add(objectHistoryKey(tuple, revision), value)
+		})
+	case userHistoryPrefix:
+		err = scanStringHistory(reader, stringUserHistoryPrefix+stringKey(components, partial, "@", "#"), func(tuple ACLTuple, revision uint64, value []byte) {
+			add(userHistoryKey(tuple, revision), value)
+		})
+	case relationHistoryPrefix:
+		err = scanStringHistory(reader, stringUserHistoryPrefix+user, func(tuple ACLTuple, revision uint64, value []byte) {
+			add(relationHistoryKey(tuple, revision), value)
+		})
+	}
+	return entries, err
+}
+
+// scanStringTuples passes the string layout primary entries whose keys
+// start with prefix to fn
+func scanStringTuples(reader dbReader, prefix string, fn func(ACLTuple, []byte)) error {
+	r, ok := stringDataRange(prefix)
+	if !ok {
+		return nil
+	}
+	iter := reader.NewIterator(r, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if len(iter.Value()) == 0 {
+			continue // A reverse entry
+		}
+		var tuple ACLTuple
+		if err := json.Unmarshal(iter.Value(), &tuple); err != nil {
+			continue // Skip malformed entries
+		}
+		fn(tuple, iter.Value())
+	}
+	return iter.Error()
+}
+
+// scanStringReverse passes the tuples of the string layout reverse entries
+// whose keys start with prefix to fn. The string layout wrote every reverse
+// entry in the same batch as its primary entry, and the tuple is stored as
+// long as that primary entry is.
+func scanStringReverse(reader dbReader, prefix string, fn func(ACLTuple)) error {
+	r, ok := stringDataRange(prefix)
+	if !ok {
+		return nil
+	}
+	iter := reader.NewIterator(r, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if len(iter.Value()) > 0 {
+			continue // A primary entry
+		}
+		tuple, err := parseStringReverseKey(string(iter.Key()))
+		if err != nil {
+			continue // Skip malformed entries
+		}
+		if _, err := reader.Get([]byte(stringTupleKey(tuple)), nil); err == leveldb.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		fn(tuple)
+	}
+	return iter.Error()
+}
+
+// scanStringHistory passes the string layout history entries whose keys
+// start with prefix to fn
+func scanStringHistory(reader dbReader, prefix string, fn func(ACLTuple, uint64, []byte)) error {
+	iter := reader.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		tuple, revision, ok := parseStringHistoryEntry(iter.Key(), iter.Value())
+		if !ok {
+			continue // Skip malformed entries
+		}
+		fn(tuple, revision, iter.Value())
+	}
+	return iter.Error()
+}
+
+// stringDataRange returns the range of the string layout tuple and reverse
+// keys starting with prefix, which is empty if prefix sorts before them
+func stringDataRange(prefix string) (*util.Range, bool) {
+	r := util.BytesPrefix([]byte(prefix))
+	if bytes.Compare(r.Start, stringDataStart) < 0 {
+		if r.Limit != nil && bytes.Compare(r.Limit, stringDataStart) <= 0 {
+			return nil, false
+		}
+		r.Start = stringDataStart
+	}
+	return r, true
+}
+
+// stringKey joins the components of a key of the current layout with the
+// separators of the string layout, followed by the partial component
+func stringKey(components []string, partial string, separators ...string) string {
+	var key strings.Builder
+	for i, component := range components {
+		key.WriteString(component)
+		if i < len(separators) {
+			key.WriteString(separators[i])
+		}
+	}
+	key.WriteString(partial)
+	return key.String()
+}
+
+// stringTupleKey formats the string layout key object#relation@user
+func stringTupleKey(tuple ACLTuple) string {
+	return tuple.Object + "#" + tuple.Relation + "@" + tuple.User
+}
+
+// stringReverseKey formats the string layout key user@object#relation
+func stringReverseKey(tuple ACLTuple) string {
+	return tuple.User + "@" + tuple.Object + "#" + tuple.Relation
+}
+
+// parseStringHistoryEntry parses a string layout history entry into its
+// tuple and revision. Deletions carry no tuple, so theirs is parsed from the
+// key.
+func parseStringHistoryEntry(key, value []byte) (ACLTuple, uint64, bool) {
+	if len(key) < len(stringObjectHistoryPrefix)+9 || key[len(key)-9] != 0 {
+		return ACLTuple{}, 0, false
+	}
+	revision := binary.BigEndian.Uint64(key[len(key)-8:])
+	entry := string(key[len(stringObjectHistoryPrefix) : len(key)-9])
+
+	var tuple ACLTuple
+	var err error
+	switch {
+	case len(value) > 0:
+		err = json.Unmarshal(value, &tuple)
+	case bytes.HasPrefix(key, []byte(stringObjectHistoryPrefix)):
+		tuple, err = parseStringTupleKey(entry)
+	default:
+		tuple, err = parseStringReverseKey(entry)
+	}
+	return tuple, revision, err == nil
+}
+
+// parseStringTupleKey parses a string layout key object#relation@user. The
+// user may be a userset such as group:eng#member, so the key is split on the
+// first separators only.
+func parseStringTupleKey(key string) (ACLTuple, error) {
+	objRel, user, found := strings.Cut(key, "@")
+	if !found {
+		return ACLTuple{}, fmt.Errorf("invalid tuple key format: missing @")
+	}
+
+	object, relation, found := strings.Cut(objRel, "#")
+	if !found {
+		return ACLTuple{}, fmt.Errorf("invalid tuple key format: missing #")
+	}
+
+	return ACLTuple{Object: object, Relation: relation, User: user}, nil
+}
+
+// parseStringReverseKey parses a string layout key user@object#relation
+func parseStringReverseKey(key string) (ACLTuple, error) {
+	user, objRel, found := strings.Cut(key, "@")
+	if !found {
+		return ACLTuple{}, fmt.Errorf("invalid reverse key format: missing @")
+	}
+
+	object, relation, found := strings.Cut(objRel, "#")
+	if !found || strings.Contains(relation, "#") {
+		return ACLTuple{}, fmt.Errorf("invalid reverse key format: missing #")
+	}
+
+	return ACLTuple{Object: object, Relation: relation, User: user}, nil
+}
+
+// ensureRelationIndex adds the relation index entries of tuples stored
+// before the relation index existed. Tuples still in the string layout get
+// theirs when they are migrated. Rewriting an entry is harmless, so an
+// interrupted run simply starts over.
+func (c *Client) ensureRelationIndex() error {
+	if _, err := c.db.Get(relationIndexMarkerKey, nil); err == nil {
+		return nil
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+
+	iter := c.db.NewIterator(util.BytesPrefix([]byte(primaryPrefix)), nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		tuple, err := c.parseTupleKey(iter.Key())
+		if err != nil {
+			continue // Leave malformed entries for inspection
+		}
+		batch.Put(c.formatRelationKey(tuple), []byte{})
+
+		if batch.Len() >= migrateBatchSize {
+			if err := c.db.Write(batch, nil); err != nil {
+				return fmt.Errorf("failed to write batch: %w", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	batch.Put(relationIndexMarkerKey, []byte{1})
+	if err := c.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("failed to write final batch: %w", err)
+	}
+	return nil
+}
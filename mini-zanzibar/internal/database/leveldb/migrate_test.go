@@ -0,0 +1,105 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadsMergeLayoutsDuringMigration(t *testing.T) {
+	client, err := NewClient(filepath.Join(t.TempDir(), "leveldb"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	written := ACLTuple{Object: "doc:readme", Relation: "editor", User: "user:bob"}
+	if err := client.StoreTuple(written); err != nil {
+		t.Fatalf("StoreTuple: %v", err)
+	}
+
+	// Tuples and history of the string layout, still waiting to be migrated
+	viewer := ACLTuple{Object: "doc:readme", Relation: "viewer", User: "group:eng#member"}
+	member := ACLTuple{Object: "group:eng", Relation: "member", User: "user:alice"}
+	for _, tuple := range []ACLTuple{viewer, member} {
+		value, _ := json.Marshal(tuple)
+		client.db.Put([]byte(stringTupleKey(tuple)), value, nil)
+		client.db.Put([]byte(stringReverseKey(tuple)), []byte{}, nil)
+		client.db.Put(append([]byte(stringObjectHistoryPrefix+stringTupleKey(tuple)+"\x00"), encodeRevision(1)...), value, nil)
+		client.db.Put(append([]byte(stringUserHistoryPrefix+stringReverseKey(tuple)+"\x00"), encodeRevision(1)...), value, nil)
+	}
+	client.migrating.Store(true)
+
+	assertTuples := func(name string, got []ACLTuple, err error, want ...ACLTuple) {
+		t.Helper()
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	assertReads := func(stage string) {
+		t.Helper()
+		tuples, err := client.ListTuplesByObject("doc:readme")
+		assertTuples(stage+" ListTuplesByObject", tuples, err, written, viewer)
+		tuples, err = client.ListTuplesByUser("user:alice")
+		assertTuples(stage+" ListTuplesByUser", tuples, err, member)
+		tuples, err = client.ListTuplesByUserAndRelation("group:eng#member", "viewer")
+		assertTuples(stage+" ListTuplesByUserAndRelation", tuples, err, viewer)
+
+		page, cursor, err := client.ListTuplesByObjectPagination("doc:readme", "", 1)
+		assertTuples(stage+" first page", page, err, written)
+		page, cursor, err = client.ListTuplesByObjectPagination("doc:readme", cursor, 1)
+		assertTuples(stage+" second page", page, err, viewer)
+		if cursor != "" {
+			t.Errorf("%s second page cursor = %q, want the last page", stage, cursor)
+		}
+
+		tuples = nil
+		_, err = client.QueryTuples(TupleFilter{SubjectType: "user"}, "", 10, func(tuple ACLTuple) error {
+			tuples = append(tuples, tuple)
+			return nil
+		})
+		assertTuples(stage+" QueryTuples", tuples, err, member, written)
+
+		snapshot, err := client.Snapshot(1)
+		if err != nil {
+			t.Fatalf("%s Snapshot: %v", stage, err)
+		}
+		tuples, err = snapshot.ListTuplesByUser("user:alice")
+		assertTuples(stage+" snapshot ListTuplesByUser", tuples, err, member)
+		tuples, err = snapshot.ListTuplesByUserAndRelation("group:eng#member", "viewer")
+		assertTuples(stage+" snapshot ListTuplesByUserAndRelation", tuples, err, viewer)
+	}
+
+	assertReads("during migration")
+
+	// A write replaces the string layout entries of the tuple it changes
+	removed := ACLTuple{Object: "group:eng", Relation: "member", User: "user:carol"}
+	value, _ := json.Marshal(removed)
+	client.db.Put([]byte(stringTupleKey(removed)), value, nil)
+	client.db.Put([]byte(stringReverseKey(removed)), []byte{}, nil)
+	if err := client.DeleteTuple(removed.Object, removed.Relation, removed.User); err != nil {
+		t.Fatalf("DeleteTuple: %v", err)
+	}
+	if tuple, err := client.GetTuple(removed.Object, removed.Relation, removed.User); err != nil || tuple != nil {
+		t.Errorf("GetTuple after delete = %v, %v, want nil", tuple, err)
+	}
+
+	if err := client.MigrateExistingData(); err != nil {
+		t.Fatalf("MigrateExistingData: %v", err)
+	}
+	if client.Migrating() {
+		t.Errorf("Migrating after migration = true, want false")
+	}
+	assertReads("after migration")
+
+	iter := client.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if key[0] >= stringDataStart[0] || bytes.HasPrefix(key, []byte(stringObjectHistoryPrefix)) || bytes.HasPrefix(key, []byte(stringUserHistoryPrefix)) {
+			t.Errorf("string layout key %q left after migration", key)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package leveldb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TupleFilter selects tuples by the components of their object and user.
+// Empty fields match everything. The object is namespace:object_id and the
+// user subject_type:subject_id, where the subject id of a userset includes
+// its relation, e.g. eng#member.
+type TupleFilter struct {
+	Namespace      string
+	ObjectID       string
+	ObjectIDPrefix string
+	Relation       string
+	SubjectType    string
+	SubjectID      string
+}
+
+// Validate reports filters whose fields cannot be combined
+func (f TupleFilter) Validate() error {
+	if (f.ObjectID != "" || f.ObjectIDPrefix != "") && f.Namespace == "" {
+		return fmt.Errorf("namespace is required to filter by object id")
+	}
+	if f.ObjectID != "" && f.ObjectIDPrefix != "" {
+		return fmt.Errorf("object_id and object_id_prefix are mutually exclusive")
+	}
+	if f.SubjectID != "" && f.SubjectType == "" {
+		return fmt.Errorf("subject_type is required to filter by subject id")
+	}
+	return nil
+}
+
+// Match reports whether tuple passes the filter
+func (f TupleFilter) Match(tuple ACLTuple) bool {
+	namespace, objectID, _ := strings.Cut(tuple.Object, ":")
+	subjectType, subjectID, _ := strings.Cut(tuple.User, ":")
+
+	return (f.Namespace == "" || namespace == f.Namespace) &&
+		(f.ObjectID == "" || objectID == f.ObjectID) &&
+		strings.HasPrefix(objectID, f.ObjectIDPrefix) &&
+		(f.Relation == "" || tuple.Relation == f.Relation) &&
+		(f.SubjectType == "" || subjectType == f.SubjectType) &&
+		(f.SubjectID == "" || subjectID == f.SubjectID)
+}
+
+// QueryIndex names an index a tuple query scans
+type QueryIndex int
+
+const (
+	// PrimaryIndex orders tuples by object, relation and user
+	PrimaryIndex QueryIndex = iota
+	// ReverseIndex orders tuples by user, object and relation
+	ReverseIndex
+	// RelationIndex orders tuples by user, relation and object
+	RelationIndex
+)
+
+// QueryPlan returns the most selective index for filter and the prefix of
+// the keys to scan, without the index's own key prefix, so other backends
+// can order and page queries like the indexes do. A subject id selects the
+// subject's relation or reverse index, a namespace the primary index, and a
+// subject type the reverse index; the prefix is narrowed by the object
+// filters wherever the index order allows.
+func QueryPlan(filter TupleFilter) (QueryIndex, string) {
+	user := filter.SubjectType + ":" + filter.SubjectID
+	switch {
+	case filter.SubjectID != "" && filter.Relation != "":
+		return RelationIndex, string(narrowByObject(encodeKey("", user, filter.Relation), filter, ""))
+	case filter.SubjectID != "":
+		return ReverseIndex, string(narrowByObject(encodeKey("", user), filter, filter.Relation))
+	case filter.Namespace != "":
+		return PrimaryIndex, string(narrowByObject(nil, filter, filter.Relation))
+	case filter.SubjectType != "":
+		return ReverseIndex, string(appendPartialComponent(nil, filter.SubjectType+":"))
+	}
+	return PrimaryIndex, ""
+}
+
+// QueryTuples passes a page of at most pageSize tuples matching filter to
+// emit, starting after cursor, and returns the cursor of the next page, or
+// "" after the last page. The scan covers the keys QueryPlan selects; fields
+// the index does not cover are filtered while scanning.
+func (c *Client) QueryTuples(filter TupleFilter, cursor string, pageSize int, emit func(ACLTuple) error) (string, error) {
+	if err := filter.Validate(); err != nil {
+		return "", err
+	}
+
+	index, components := QueryPlan(filter)
+	var prefix []byte
+	var parse func([]byte) (ACLTuple, error)
+	switch index {
+	case RelationIndex:
+		prefix, parse = []byte(relationPrefix+components), c.parseRelationKey
+	case ReverseIndex:
+		prefix, parse = []byte(reversePrefix+components), c.parseReverseKey
+	default:
+		prefix, parse = []byte(primaryPrefix+components), c.parseTupleKey
+	}
+
+	// Every index key holds the whole tuple, and all indexes are written in
+	// one batch, so the scan needs no primary lookups
+	return c.scanPage(prefix, cursor, pageSize, func(key, _ []byte) (*ACLTuple, error) {
+		tuple, err := parse(key)
+		if err != nil || !filter.Match(tuple) {
+			return nil, nil // Skip malformed and filtered entries
+		}
+		return &tuple, nil
+	}, emit)
+}
+
+// narrowByObject appends the object filter to the prefix of an index whose
+// keys continue with the object: the exact object, followed by relation if
+// given, or the partial object of a namespace or object id prefix
+func narrowByObject(key []byte, filter TupleFilter, relation string) []byte {
+	switch {
+	case filter.ObjectID != "":
+		key = appendComponent(key, filter.Namespace+":"+filter.ObjectID)
+		if relation != "" {
+			key = appendComponent(key, relation)
+		}
+	case filter.Namespace != "":
+		key = appendPartialComponent(key, filter.Namespace+":"+filter.ObjectIDPrefix)
+	}
+	return key
+}
+
+// appendPartialComponent appends an escaped but unterminated component, which
+// prefixes the keys of every component starting with it
+func appendPartialComponent(key []byte, component string) []byte {
+	key = appendComponent(key, component)
+	return key[:len(key)-2]
+}
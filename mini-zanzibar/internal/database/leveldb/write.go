@@ -0,0 +1,102 @@
+package leveldb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OperationCreate stores a tuple that must not exist yet. The changelog
+// records it as a touch.
+const OperationCreate = "create"
+
+// Conditions of a write precondition
+const (
+	ConditionMustExist    = "must_exist"
+	ConditionMustNotExist = "must_not_exist"
+)
+
+// ErrPreconditionFailed is returned by writes whose preconditions do not
+// hold, including creates of tuples that already exist
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrDuplicateChange is returned by writes that change a tuple more than
+// once, whose outcome would depend on the order of the changes
+var ErrDuplicateChange = errors.New("tuple is changed more than once")
+
+// Precondition is a condition on a tuple that must hold for a write to be
+// applied
+type Precondition struct {
+	Condition string   `json:"condition"`
+	Tuple     ACLTuple `json:"tuple"`
+}
+
+// Write applies changes atomically as a single revision if all
+// preconditions hold against the tuples before the write. Every tuple may
+// be changed at most once; nothing is written if a tuple is changed twice
+// or any precondition fails.
+func (c *Client) Write(changes []Change, preconditions []Precondition) error {
+	return c.commit(changes, preconditions)
+}
+
+// NormalizeChanges validates the operations of changes, rejects tuples
+// changed more than once with ErrDuplicateChange and turns creates into
+// touches. Use CreatePreconditions to keep their guarantee.
+func NormalizeChanges(changes []Change) ([]Change, error) {
+	normalized := make([]Change, len(changes))
+	changed := make(map[ACLTuple]bool, len(changes))
+	for i, change := range changes {
+		switch change.Operation {
+		case OperationTouch, OperationDelete:
+		case OperationCreate:
+			change.Operation = OperationTouch
+		default:
+			return nil, fmt.Errorf("unknown operation %q", change.Operation)
+		}
+
+		tuple := change.Tuple
+		if changed[tuple] {
+			return nil, fmt.Errorf("%w: %s#%s@%s", ErrDuplicateChange, tuple.Object, tuple.Relation, tuple.User)
+		}
+		changed[tuple] = true
+		normalized[i] = change
+	}
+	return normalized, nil
+}
+
+// CreatePreconditions returns the preconditions implied by the create
+// operations of changes
+func CreatePreconditions(changes []Change) []Precondition {
+	var preconditions []Precondition
+	for _, change := range changes {
+		if change.Operation == OperationCreate {
+			preconditions = append(preconditions, Precondition{Condition: ConditionMustNotExist, Tuple: change.Tuple})
+		}
+	}
+	return preconditions
+}
+
+// CheckPreconditions returns an error wrapping ErrPreconditionFailed for the
+// first precondition that does not hold, looking tuples up with lookup
+func CheckPreconditions(preconditions []Precondition, lookup func(ACLTuple) (bool, error)) error {
+	for _, precondition := range preconditions {
+		tuple := precondition.Tuple
+		exists, err := lookup(tuple)
+		if err != nil {
+			return err
+		}
+
+		switch precondition.Condition {
+		case ConditionMustExist:
+			if !exists {
+				return fmt.Errorf("%w: %s#%s@%s does not exist", ErrPreconditionFailed, tuple.Object, tuple.Relation, tuple.User)
+			}
+		case ConditionMustNotExist:
+			if exists {
+				return fmt.Errorf("%w: %s#%s@%s already exists", ErrPreconditionFailed, tuple.Object, tuple.Relation, tuple.User)
+			}
+		default:
+			return fmt.Errorf("unknown precondition %q", precondition.Condition)
+		}
+	}
+	return nil
+}
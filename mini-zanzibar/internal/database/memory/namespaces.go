@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"mini-zanzibar/internal/database/consul"
+)
+
+// NamespaceStore is an in-memory namespace store with the same versioning
+// semantics as the Consul client. Configurations are kept marshaled so
+// callers never share maps with the store.
+type NamespaceStore struct {
+	mu       sync.RWMutex
+	versions map[string][][]byte
+}
+
+// NewNamespaceStore creates an empty in-memory namespace store
+func NewNamespaceStore() *NamespaceStore {
+	return &NamespaceStore{
+		versions: make(map[string][][]byte),
+	}
+}
+
+// StoreNamespace stores a namespace configuration with versioning
+func (s *NamespaceStore) StoreNamespace(namespace string, config consul.NamespaceConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config.Version = len(s.versions[namespace]) + 1
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal namespace config: %w", err)
+	}
+
+	s.versions[namespace] = append(s.versions[namespace], data)
+	return nil
+}
+
+// GetNamespace retrieves the latest namespace configuration
+func (s *NamespaceStore) GetNamespace(namespace string) (*consul.NamespaceConfig, error) {
+	s.mu.RLock()
+	version := len(s.versions[namespace])
+	s.mu.RUnlock()
+
+	if version == 0 {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+
+	return s.GetNamespaceVersion(namespace, version)
+}
+
+// GetNamespaceVersion retrieves a specific version of namespace configuration
+func (s *NamespaceStore) GetNamespaceVersion(namespace string, version int) (*consul.NamespaceConfig, error) {
+	s.mu.RLock()
+	versions := s.versions[namespace]
+	s.mu.RUnlock()
+
+	if version < 1 || version > len(versions) {
+		return nil, fmt.Errorf("namespace version not found: %s v%d", namespace, version)
+	}
+
+	var config consul.NamespaceConfig
+	if err := json.Unmarshal(versions[version-1], &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal namespace config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// ListNamespaces returns all available namespaces
+func (s *NamespaceStore) ListNamespaces() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var namespaces []string
+	for namespace := range s.versions {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// DeleteNamespace removes all versions of a namespace
+func (s *NamespaceStore) DeleteNamespace(namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.versions, namespace)
+	return nil
+}
+
+// NamespaceExists checks if a namespace exists
+func (s *NamespaceStore) NamespaceExists(namespace string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.versions[namespace]) > 0, nil
+}
+
+// RelationExists check if a relation is valid for a namespace
+func (s *NamespaceStore) RelationExists(namespace, relation string) (bool, error) {
+	config, err := s.GetNamespace(namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	_, exists := config.Relations[relation]
+	return exists, nil
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/memory"
+	"mini-zanzibar/internal/database/storetest"
+)
+
+func TestNamespaceStoreConformance(t *testing.T) {
+	storetest.RunNamespaceStoreTests(t, func(t *testing.T) database.NamespaceStore {
+		return memory.NewNamespaceStore()
+	})
+}
@@ -0,0 +1,398 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+// TupleStore is an in-memory tuple store with the same ordering and
+// pagination semantics as the LevelDB client
+type TupleStore struct {
+	mu       sync.RWMutex
+	tuples   map[string]leveldb.ACLTuple
+	revision uint64
+
+	// history holds the versions of every tuple by primary key, ordered by
+	// revision; commits holds the commit time of every retained revision
+	history map[string][]version
+	commits map[uint64]time.Time
+	oldest  uint64
+
+	// changes holds the change sets after oldest; changed is closed and
+	// replaced by every commit
+	changes []leveldb.ChangeSet
+	changed chan struct{}
+}
+
+// version is a tuple as written at a revision
+type version struct {
+	revision uint64
+	tuple    leveldb.ACLTuple
+	deleted  bool
+}
+
+// NewTupleStore creates an empty in-memory tuple store
+func NewTupleStore() *TupleStore {
+	return &TupleStore{
+		tuples:  make(map[string]leveldb.ACLTuple),
+		history: make(map[string][]version),
+		commits: make(map[uint64]time.Time),
+		changed: make(chan struct{}),
+	}
+}
+
+// Close is a no-op for the in-memory store
+func (s *TupleStore) Close() error {
+	return nil
+}
+
+// StoreTuple stores an ACL tuple, overwriting an identical one
+func (s *TupleStore) StoreTuple(tuple leveldb.ACLTuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tuples[tupleKey(tuple)] = tuple
+	s.commit(leveldb.Change{Operation: leveldb.OperationTouch, Tuple: tuple})
+	return nil
+}
+
+// Revision returns the revision of the last committed write
+func (s *TupleStore) Revision() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.revision, nil
+}
+
+// GetTuple retrieves a specific ACL tuple, returning nil if it does not exist
+func (s *TupleStore) GetTuple(object, relation, user string) (*leveldb.ACLTuple, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tuple, exists := s.tuples[tupleKey(leveldb.ACLTuple{Object: object, Relation: relation, User: user})]
+	if !exists {
+		return nil, nil
+	}
+	return &tuple, nil
+}
+
+// DeleteTuple removes an ACL tuple
+func (s *TupleStore) DeleteTuple(object, relation, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tuple := leveldb.ACLTuple{Object: object, Relation: relation, User: user}
+	delete(s.tuples, tupleKey(tuple))
+	s.commit(leveldb.Change{Operation: leveldb.OperationDelete, Tuple: tuple})
+	return nil
+}
+
+// Write applies changes atomically as a single revision if all
+// preconditions hold against the tuples before the write
+func (s *TupleStore) Write(changes []leveldb.Change, preconditions []leveldb.Precondition) error {
+	preconditions = append(leveldb.CreatePreconditions(changes), preconditions...)
+	changes, err := leveldb.NormalizeChanges(changes)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := leveldb.CheckPreconditions(preconditions, func(tuple leveldb.ACLTuple) (bool, error) {
+		_, exists := s.tuples[tupleKey(tuple)]
+		return exists, nil
+	}); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if change.Operation == leveldb.OperationDelete {
+			delete(s.tuples, tupleKey(change.Tuple))
+		} else {
+			s.tuples[tupleKey(change.Tuple)] = change.Tuple
+		}
+	}
+	s.commit(changes...)
+	return nil
+}
+
+// commit records changes, already applied to the tuples, as the next
+// revision. The caller must hold the write lock.
+func (s *TupleStore) commit(changes ...leveldb.Change) {
+	s.revision++
+	s.commits[s.revision] = time.Now()
+
+	for _, change := range changes {
+		key := tupleKey(change.Tuple)
+		s.history[key] = append(s.history[key], version{
+			revision: s.revision,
+			tuple:    change.Tuple,
+			deleted:  change.Operation == leveldb.OperationDelete,
+		})
+	}
+
+	s.changes = append(s.changes, leveldb.ChangeSet{Revision: s.revision, Changes: changes})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// ReadChanges returns the change sets committed after revision since,
+// oldest first and at most limit of them
+func (s *TupleStore) ReadChanges(since uint64, limit int) ([]leveldb.ChangeSet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if since > s.revision {
+		return nil, leveldb.ErrFutureRevision
+	}
+	if since < s.oldest {
+		return nil, leveldb.ErrSnapshotExpired
+	}
+
+	start := sort.Search(len(s.changes), func(i int) bool {
+		return s.changes[i].Revision > since
+	})
+	end := len(s.changes)
+	if limit > 0 && end-start > limit {
+		end = start + limit
+	}
+	return append([]leveldb.ChangeSet(nil), s.changes[start:end]...), nil
+}
+
+// Changed returns a channel that is closed by the next commit
+func (s *TupleStore) Changed() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.changed
+}
+
+// Snapshot returns a reader of the tuples as they were at revision
+func (s *TupleStore) Snapshot(revision uint64) (leveldb.TupleReader, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if revision > s.revision {
+		return nil, leveldb.ErrFutureRevision
+	}
+	if revision < s.oldest {
+		return nil, leveldb.ErrSnapshotExpired
+	}
+
+	// Copy the visible versions into a read-only store, so later writes and
+	// garbage collection cannot affect the snapshot
+	snapshot := NewTupleStore()
+	for key, versions := range s.history {
+		if tuple, ok := visible(versions, revision); ok {
+			snapshot.tuples[key] = tuple
+		}
+	}
+	return snapshot, nil
+}
+
+// GarbageCollect removes the tuple versions that are only visible to
+// revisions committed more than retention ago and returns how many were removed
+func (s *TupleStore) GarbageCollect(retention time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+	oldest := s.oldest
+	for revision, committed := range s.commits {
+		if revision > oldest && !committed.After(cutoff) {
+			oldest = revision
+		}
+	}
+	if oldest == s.oldest {
+		return 0, nil
+	}
+
+	removed := 0
+	for key, versions := range s.history {
+		// Keep the version visible at oldest unless it is a deletion, and
+		// every later one
+		drop := 0
+		for drop < len(versions) && versions[drop].revision <= oldest {
+			drop++
+		}
+		if drop > 0 && !versions[drop-1].deleted {
+			drop--
+		}
+
+		removed += drop
+		if drop == len(versions) {
+			delete(s.history, key)
+		} else {
+			s.history[key] = versions[drop:]
+		}
+	}
+
+	for revision := range s.commits {
+		if revision < oldest {
+			delete(s.commits, revision)
+		}
+	}
+	start := sort.Search(len(s.changes), func(i int) bool {
+		return s.changes[i].Revision > oldest
+	})
+	s.changes = append([]leveldb.ChangeSet(nil), s.changes[start:]...)
+	s.oldest = oldest
+
+	return removed, nil
+}
+
+// visible returns the version of a tuple visible at revision, if any
+func visible(versions []version, revision uint64) (leveldb.ACLTuple, bool) {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].revision <= revision {
+			return versions[i].tuple, !versions[i].deleted
+		}
+	}
+	return leveldb.ACLTuple{}, false
+}
+
+// CheckTuple checks if a specific tuple exists
+func (s *TupleStore) CheckTuple(object, relation, user string) (bool, error) {
+	tuple, err := s.GetTuple(object, relation, user)
+	if err != nil {
+		return false, err
+	}
+	return tuple != nil, nil
+}
+
+// ListTuplesByObject returns all tuples for a specific object
+func (s *TupleStore) ListTuplesByObject(object string) ([]leveldb.ACLTuple, error) {
+	return s.filter(tupleKey, func(t leveldb.ACLTuple) bool {
+		return t.Object == object
+	}), nil
+}
+
+// ListTuplesByObjectAndRelation returns all tuples for a specific object and relation
+func (s *TupleStore) ListTuplesByObjectAndRelation(object, relation string) ([]leveldb.ACLTuple, error) {
+	return s.filter(tupleKey, func(t leveldb.ACLTuple) bool {
+		return t.Object == object && t.Relation == relation
+	}), nil
+}
+
+// ListTuplesByUser returns all tuples for a specific user
+func (s *TupleStore) ListTuplesByUser(user string) ([]leveldb.ACLTuple, error) {
+	return s.filter(reverseKey, func(t leveldb.ACLTuple) bool {
+		return t.User == user
+	}), nil
+}
+
+// ListTuplesByUserAndRelation returns all tuples for a specific user and relation
+func (s *TupleStore) ListTuplesByUserAndRelation(user, relation string) ([]leveldb.ACLTuple, error) {
+	return s.filter(relationKey, func(t leveldb.ACLTuple) bool {
+		return t.User == user && t.Relation == relation
+	}), nil
+}
+
+// ListTuplesByObjectPagination returns a page of tuples for a specific object
+func (s *TupleStore) ListTuplesByObjectPagination(object, cursor string, pageSize int) ([]leveldb.ACLTuple, string, error) {
+	tuples, _ := s.ListTuplesByObject(object)
+	return paginate(tuples, tupleKey, leveldb.EncodeComponents(object), cursor, pageSize)
+}
+
+// ListTuplesByUserPagination returns a page of tuples for a specific user
+func (s *TupleStore) ListTuplesByUserPagination(user, cursor string, pageSize int) ([]leveldb.ACLTuple, string, error) {
+	tuples, _ := s.ListTuplesByUser(user)
+	return paginate(tuples, reverseKey, leveldb.EncodeComponents(user), cursor, pageSize)
+}
+
+// QueryTuples passes a page of the tuples matching filter to emit
+func (s *TupleStore) QueryTuples(filter leveldb.TupleFilter, cursor string, pageSize int, emit func(leveldb.ACLTuple) error) (string, error) {
+	if err := filter.Validate(); err != nil {
+		return "", err
+	}
+
+	// Order and page the tuples like the index a LevelDB query scans
+	index, prefix := leveldb.QueryPlan(filter)
+	key := tupleKey
+	switch index {
+	case leveldb.RelationIndex:
+		key = relationKey
+	case leveldb.ReverseIndex:
+		key = reverseKey
+	}
+
+	tuples, next, err := paginate(s.filter(key, filter.Match), key, prefix, cursor, pageSize)
+	if err != nil {
+		return "", err
+	}
+	for _, tuple := range tuples {
+		if err := emit(tuple); err != nil {
+			return "", err
+		}
+	}
+	return next, nil
+}
+
+// filter returns the matching tuples ordered by the given key, mirroring
+// the order a LevelDB prefix scan over that index would produce
+func (s *TupleStore) filter(key func(leveldb.ACLTuple) string, match func(leveldb.ACLTuple) bool) []leveldb.ACLTuple {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tuples []leveldb.ACLTuple
+	for _, tuple := range s.tuples {
+		if match(tuple) {
+			tuples = append(tuples, tuple)
+		}
+	}
+
+	sort.Slice(tuples, func(i, j int) bool {
+		return key(tuples[i]) < key(tuples[j])
+	})
+
+	return tuples
+}
+
+// paginate slices the page following cursor out of a result set ordered by
+// key. The cursor encodes the key of the last tuple of the previous page,
+// which must start with the listing's prefix.
+func paginate(tuples []leveldb.ACLTuple, key func(leveldb.ACLTuple) string, prefix, cursor string, pageSize int) ([]leveldb.ACLTuple, string, error) {
+	after, err := leveldb.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if after != nil && !strings.HasPrefix(string(after), prefix) {
+		return nil, "", leveldb.ErrInvalidCursor
+	}
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(tuples), func(i int) bool {
+			return key(tuples[i]) > string(after)
+		})
+	}
+	if start >= len(tuples) {
+		return nil, "", nil
+	}
+
+	end := start + pageSize
+	if end >= len(tuples) {
+		return tuples[start:], "", nil
+	}
+	return tuples[start:end], leveldb.EncodeCursor([]byte(key(tuples[end-1]))), nil
+}
+
+// tupleKey formats the primary key from object, relation and user
+func tupleKey(tuple leveldb.ACLTuple) string {
+	return leveldb.EncodeComponents(tuple.Object, tuple.Relation, tuple.User)
+}
+
+// reverseKey formats the reverse index key from user, object and relation
+func reverseKey(tuple leveldb.ACLTuple) string {
+	return leveldb.EncodeComponents(tuple.User, tuple.Object, tuple.Relation)
+}
+
+// relationKey formats the relation index key from user, relation and object
+func relationKey(tuple leveldb.ACLTuple) string {
+	return leveldb.EncodeComponents(tuple.User, tuple.Relation, tuple.Object)
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/memory"
+	"mini-zanzibar/internal/database/storetest"
+)
+
+func TestTupleStoreConformance(t *testing.T) {
+	storetest.RunTupleStoreTests(t, func(t *testing.T) database.TupleStore {
+		return memory.NewTupleStore()
+	})
+}
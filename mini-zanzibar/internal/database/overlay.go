@@ -0,0 +1,97 @@
+package database
+
+import "mini-zanzibar/internal/database/leveldb"
+
+// Overlay is a TupleReader that adds a fixed set of tuples on top of another
+// reader without writing them anywhere, e.g. the contextual tuples of a
+// single check request
+type Overlay struct {
+	base   TupleReader
+	tuples []leveldb.ACLTuple
+}
+
+// NewOverlay creates a reader returning the tuples of base plus tuples
+func NewOverlay(base TupleReader, tuples []leveldb.ACLTuple) *Overlay {
+	return &Overlay{
+		base:   base,
+		tuples: tuples,
+	}
+}
+
+// GetTuple retrieves a specific tuple from the overlay or the base reader
+func (o *Overlay) GetTuple(object, relation, user string) (*leveldb.ACLTuple, error) {
+	for _, tuple := range o.tuples {
+		if tuple.Object == object && tuple.Relation == relation && tuple.User == user {
+			found := tuple
+			return &found, nil
+		}
+	}
+	return o.base.GetTuple(object, relation, user)
+}
+
+// CheckTuple checks if a tuple exists in the overlay or the base reader
+func (o *Overlay) CheckTuple(object, relation, user string) (bool, error) {
+	tuple, err := o.GetTuple(object, relation, user)
+	return tuple != nil, err
+}
+
+// ListTuplesByObject lists all tuples for an object
+func (o *Overlay) ListTuplesByObject(object string) ([]leveldb.ACLTuple, error) {
+	tuples, err := o.base.ListTuplesByObject(object)
+	if err != nil {
+		return nil, err
+	}
+	return o.merge(tuples, func(t leveldb.ACLTuple) bool {
+		return t.Object == object
+	}), nil
+}
+
+// ListTuplesByObjectAndRelation lists all tuples for an object with a specific relation
+func (o *Overlay) ListTuplesByObjectAndRelation(object, relation string) ([]leveldb.ACLTuple, error) {
+	tuples, err := o.base.ListTuplesByObjectAndRelation(object, relation)
+	if err != nil {
+		return nil, err
+	}
+	return o.merge(tuples, func(t leveldb.ACLTuple) bool {
+		return t.Object == object && t.Relation == relation
+	}), nil
+}
+
+// ListTuplesByUser lists all tuples for a user
+func (o *Overlay) ListTuplesByUser(user string) ([]leveldb.ACLTuple, error) {
+	tuples, err := o.base.ListTuplesByUser(user)
+	if err != nil {
+		return nil, err
+	}
+	return o.merge(tuples, func(t leveldb.ACLTuple) bool {
+		return t.User == user
+	}), nil
+}
+
+// ListTuplesByUserAndRelation lists all tuples for a user with a specific relation
+func (o *Overlay) ListTuplesByUserAndRelation(user, relation string) ([]leveldb.ACLTuple, error) {
+	tuples, err := o.base.ListTuplesByUserAndRelation(user, relation)
+	if err != nil {
+		return nil, err
+	}
+	return o.merge(tuples, func(t leveldb.ACLTuple) bool {
+		return t.User == user && t.Relation == relation
+	}), nil
+}
+
+// merge appends the overlay tuples that match to the tuples of the base
+// reader, skipping those the base already returned
+func (o *Overlay) merge(base []leveldb.ACLTuple, match func(leveldb.ACLTuple) bool) []leveldb.ACLTuple {
+	seen := make(map[leveldb.ACLTuple]bool, len(base))
+	for _, tuple := range base {
+		seen[tuple] = true
+	}
+
+	for _, tuple := range o.tuples {
+		if match(tuple) && !seen[tuple] {
+			seen[tuple] = true
+			base = append(base, tuple)
+		}
+	}
+	return base
+}
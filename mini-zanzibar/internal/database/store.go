@@ -0,0 +1,88 @@
+package database
+
+import (
+	"time"
+
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/file"
+	"mini-zanzibar/internal/database/leveldb"
+	"mini-zanzibar/internal/database/memory"
+)
+
+// TupleReader is the read side of a tuple store. It is declared next to
+// ACLTuple so backends can return readers, e.g. snapshots, of their own.
+type TupleReader = leveldb.TupleReader
+
+// TupleStore stores ACL tuples and keeps them queryable by object and by user
+type TupleStore interface {
+	TupleReader
+
+	StoreTuple(tuple leveldb.ACLTuple) error
+	DeleteTuple(object, relation, user string) error
+	// Write applies changes atomically as a single revision if all
+	// preconditions hold, and fails with leveldb.ErrPreconditionFailed
+	// otherwise. Changing a tuple more than once fails with
+	// leveldb.ErrDuplicateChange.
+	Write(changes []leveldb.Change, preconditions []leveldb.Precondition) error
+	// ListTuplesByObjectPagination and ListTuplesByUserPagination return a
+	// page of at most pageSize tuples following cursor, and the opaque cursor
+	// of the next page, or "" after the last page. An undecodable cursor, or
+	// one returned for another listing, fails with leveldb.ErrInvalidCursor.
+	ListTuplesByObjectPagination(object, cursor string, pageSize int) ([]leveldb.ACLTuple, string, error)
+	ListTuplesByUserPagination(user, cursor string, pageSize int) ([]leveldb.ACLTuple, string, error)
+	// QueryTuples passes a page of the tuples matching filter to emit as they
+	// are read, and returns the cursor of the next page like the listings
+	QueryTuples(filter leveldb.TupleFilter, cursor string, pageSize int, emit func(leveldb.ACLTuple) error) (string, error)
+	// Revision returns the revision of the last committed write. Every
+	// write commits a new, higher revision.
+	Revision() (uint64, error)
+	// Snapshot returns a reader of the tuples as they were at revision. It
+	// fails with leveldb.ErrSnapshotExpired once the versions needed have
+	// been garbage collected, and with leveldb.ErrFutureRevision for a
+	// revision not committed yet.
+	Snapshot(revision uint64) (TupleReader, error)
+	// GarbageCollect removes the tuple versions only needed by snapshots
+	// older than retention and returns how many were removed
+	GarbageCollect(retention time.Duration) (int, error)
+	// ReadChanges returns the change sets committed after revision since,
+	// oldest first and at most limit of them, failing like Snapshot if
+	// since is no longer or not yet available
+	ReadChanges(since uint64, limit int) ([]leveldb.ChangeSet, error)
+	// Changed returns a channel that is closed by the next commit
+	Changed() <-chan struct{}
+	Close() error
+}
+
+// IntegrityChecker is implemented by tuple stores whose indexes are stored
+// separately and can get out of sync
+type IntegrityChecker interface {
+	// CheckIntegrity reports inconsistent index entries and, with repair,
+	// fixes them
+	CheckIntegrity(repair bool) (*leveldb.IntegrityReport, error)
+}
+
+// NamespaceStore stores versioned namespace configurations. Every store
+// bumps the version of the namespace and keeps older versions readable.
+type NamespaceStore interface {
+	StoreNamespace(namespace string, config consul.NamespaceConfig) error
+	GetNamespace(namespace string) (*consul.NamespaceConfig, error)
+	GetNamespaceVersion(namespace string, version int) (*consul.NamespaceConfig, error)
+	ListNamespaces() ([]string, error)
+	DeleteNamespace(namespace string) error
+	NamespaceExists(namespace string) (bool, error)
+	RelationExists(namespace, relation string) (bool, error)
+}
+
+// Ensure every backend satisfies the interfaces
+var (
+	_ TupleStore = (*leveldb.Client)(nil)
+	_ TupleStore = (*memory.TupleStore)(nil)
+
+	_ TupleReader = (*Overlay)(nil)
+
+	_ IntegrityChecker = (*leveldb.Client)(nil)
+
+	_ NamespaceStore = (*consul.Client)(nil)
+	_ NamespaceStore = (*file.Client)(nil)
+	_ NamespaceStore = (*memory.NamespaceStore)(nil)
+)
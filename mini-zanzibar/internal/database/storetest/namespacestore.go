@@ -0,0 +1,154 @@
+package storetest
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/consul"
+)
+
+// RunNamespaceStoreTests runs the namespace store conformance suite. newStore
+// must return a fresh, empty store on every call.
+func RunNamespaceStoreTests(t *testing.T, newStore func(t *testing.T) database.NamespaceStore) {
+	docV1 := consul.NamespaceConfig{
+		Namespace: "doc",
+		Relations: map[string]consul.RelationConfig{
+			"owner": {},
+		},
+	}
+	docV2 := consul.NamespaceConfig{
+		Namespace: "doc",
+		Relations: map[string]consul.RelationConfig{
+			"owner": {},
+			"viewer": {
+				Union: []consul.UnionConfig{
+					{This: &consul.ThisConfig{}},
+					{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "owner"}},
+				},
+			},
+			"banned": {},
+			"can_view": {
+				Exclusion: &consul.ExclusionConfig{
+					Base: consul.UnionConfig{Intersection: []consul.UnionConfig{
+						{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "viewer"}},
+						{Union: []consul.UnionConfig{{This: &consul.ThisConfig{}}}},
+					}},
+					Subtract: consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "banned"}},
+				},
+			},
+		},
+	}
+
+	t.Run("Versioning", func(t *testing.T) {
+		store := newStore(t)
+		mustStoreNamespace(t, store, docV1)
+		mustStoreNamespace(t, store, docV2)
+
+		latest, err := store.GetNamespace("doc")
+		if err != nil {
+			t.Fatalf("GetNamespace: %v", err)
+		}
+		want := docV2
+		want.Version = 2
+		if !reflect.DeepEqual(*latest, want) {
+			t.Errorf("GetNamespace = %+v, want %+v", *latest, want)
+		}
+
+		first, err := store.GetNamespaceVersion("doc", 1)
+		if err != nil {
+			t.Fatalf("GetNamespaceVersion(1): %v", err)
+		}
+		want = docV1
+		want.Version = 1
+		if !reflect.DeepEqual(*first, want) {
+			t.Errorf("GetNamespaceVersion(1) = %+v, want %+v", *first, want)
+		}
+
+		if _, err := store.GetNamespaceVersion("doc", 3); err == nil {
+			t.Errorf("GetNamespaceVersion(3) succeeded, want error")
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		store := newStore(t)
+		if _, err := store.GetNamespace("doc"); err == nil {
+			t.Errorf("GetNamespace on empty store succeeded, want error")
+		}
+		exists, err := store.NamespaceExists("doc")
+		if err != nil {
+			t.Fatalf("NamespaceExists: %v", err)
+		}
+		if exists {
+			t.Errorf("NamespaceExists on empty store = true")
+		}
+		// Objects such as a/b:x reach the store from checks, and must not
+		// fail them in one backend but not in another
+		for _, name := range []string{"a/b", `a\b`, "..", "."} {
+			if exists, err := store.NamespaceExists(name); err != nil || exists {
+				t.Errorf("NamespaceExists(%q) = %v, %v, want false, nil", name, exists, err)
+			}
+		}
+		if _, err := store.RelationExists("doc", "owner"); err == nil {
+			t.Errorf("RelationExists on missing namespace succeeded, want error")
+		}
+	})
+
+	t.Run("Relations", func(t *testing.T) {
+		store := newStore(t)
+		mustStoreNamespace(t, store, docV2)
+
+		for relation, want := range map[string]bool{"owner": true, "viewer": true, "can_view": true, "editor": false} {
+			got, err := store.RelationExists("doc", relation)
+			if err != nil {
+				t.Fatalf("RelationExists(%s): %v", relation, err)
+			}
+			if got != want {
+				t.Errorf("RelationExists(%s) = %v, want %v", relation, got, want)
+			}
+		}
+	})
+
+	t.Run("ListAndDelete", func(t *testing.T) {
+		store := newStore(t)
+		mustStoreNamespace(t, store, docV1)
+		mustStoreNamespace(t, store, consul.NamespaceConfig{Namespace: "folder", Relations: map[string]consul.RelationConfig{"owner": {}}})
+
+		namespaces, err := store.ListNamespaces()
+		if err != nil {
+			t.Fatalf("ListNamespaces: %v", err)
+		}
+		sort.Strings(namespaces)
+		if !reflect.DeepEqual(namespaces, []string{"doc", "folder"}) {
+			t.Errorf("ListNamespaces = %v, want [doc folder]", namespaces)
+		}
+
+		if err := store.DeleteNamespace("doc"); err != nil {
+			t.Fatalf("DeleteNamespace: %v", err)
+		}
+		if exists, _ := store.NamespaceExists("doc"); exists {
+			t.Errorf("namespace still exists after delete")
+		}
+		if _, err := store.GetNamespaceVersion("doc", 1); err == nil {
+			t.Errorf("old version still readable after delete")
+		}
+
+		// Versions restart after the namespace is recreated
+		mustStoreNamespace(t, store, docV2)
+		latest, err := store.GetNamespace("doc")
+		if err != nil {
+			t.Fatalf("GetNamespace after recreate: %v", err)
+		}
+		if latest.Version != 1 {
+			t.Errorf("version after recreate = %d, want 1", latest.Version)
+		}
+	})
+}
+
+func mustStoreNamespace(t *testing.T, store database.NamespaceStore, config consul.NamespaceConfig) {
+	t.Helper()
+	if err := store.StoreNamespace(config.Namespace, config); err != nil {
+		t.Fatalf("StoreNamespace(%s): %v", config.Namespace, err)
+	}
+}
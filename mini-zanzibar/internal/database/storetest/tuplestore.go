@@ -0,0 +1,578 @@
+// Package storetest contains conformance suites shared by every storage backend
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+// RunTupleStoreTests runs the tuple store conformance suite. newStore must
+// return a fresh, empty store on every call.
+func RunTupleStoreTests(t *testing.T, newStore func(t *testing.T) database.TupleStore) {
+	t.Run("StoreAndGet", func(t *testing.T) {
+		store := newStore(t)
+		tuple := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+		mustStore(t, store, tuple)
+
+		got, err := store.GetTuple("doc:readme", "viewer", "user:alice")
+		if err != nil {
+			t.Fatalf("GetTuple: %v", err)
+		}
+		if got == nil || *got != tuple {
+			t.Fatalf("GetTuple = %v, want %v", got, tuple)
+		}
+
+		missing, err := store.GetTuple("doc:readme", "editor", "user:alice")
+		if err != nil {
+			t.Fatalf("GetTuple missing: %v", err)
+		}
+		if missing != nil {
+			t.Fatalf("GetTuple missing = %v, want nil", missing)
+		}
+	})
+
+	t.Run("StoreIsIdempotent", func(t *testing.T) {
+		store := newStore(t)
+		tuple := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+		mustStore(t, store, tuple)
+		mustStore(t, store, tuple)
+
+		assertTuples(t, "ListTuplesByObject", mustList(store.ListTuplesByObject("doc:readme")), []leveldb.ACLTuple{tuple})
+		assertTuples(t, "ListTuplesByUser", mustList(store.ListTuplesByUser("user:alice")), []leveldb.ACLTuple{tuple})
+	})
+
+	t.Run("CheckTuple", func(t *testing.T) {
+		store := newStore(t)
+		mustStore(t, store, leveldb.ACLTuple{Object: "doc:readme", Relation: "owner", User: "user:alice"})
+
+		for _, tc := range []struct {
+			object, relation, user string
+			want                   bool
+		}{
+			{"doc:readme", "owner", "user:alice", true},
+			{"doc:readme", "owner", "user:bob", false},
+			{"doc:readme", "viewer", "user:alice", false},
+			{"doc:other", "owner", "user:alice", false},
+		} {
+			got, err := store.CheckTuple(tc.object, tc.relation, tc.user)
+			if err != nil {
+				t.Fatalf("CheckTuple(%s#%s@%s): %v", tc.object, tc.relation, tc.user, err)
+			}
+			if got != tc.want {
+				t.Errorf("CheckTuple(%s#%s@%s) = %v, want %v", tc.object, tc.relation, tc.user, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := newStore(t)
+		tuple := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+		mustStore(t, store, tuple)
+
+		if err := store.DeleteTuple(tuple.Object, tuple.Relation, tuple.User); err != nil {
+			t.Fatalf("DeleteTuple: %v", err)
+		}
+		if ok, _ := store.CheckTuple(tuple.Object, tuple.Relation, tuple.User); ok {
+			t.Fatalf("tuple still present after delete")
+		}
+		assertTuples(t, "ListTuplesByObject", mustList(store.ListTuplesByObject("doc:readme")), nil)
+		assertTuples(t, "ListTuplesByUser", mustList(store.ListTuplesByUser("user:alice")), nil)
+
+		// Deleting a missing tuple is not an error
+		if err := store.DeleteTuple(tuple.Object, tuple.Relation, tuple.User); err != nil {
+			t.Fatalf("DeleteTuple missing: %v", err)
+		}
+	})
+
+	t.Run("Revision", func(t *testing.T) {
+		store := newStore(t)
+		revision := mustRevision(t, store)
+
+		tuple := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+		mustStore(t, store, tuple)
+		afterStore := mustRevision(t, store)
+		if afterStore <= revision {
+			t.Errorf("revision after store = %d, want > %d", afterStore, revision)
+		}
+
+		if err := store.DeleteTuple(tuple.Object, tuple.Relation, tuple.User); err != nil {
+			t.Fatalf("DeleteTuple: %v", err)
+		}
+		if afterDelete := mustRevision(t, store); afterDelete <= afterStore {
+			t.Errorf("revision after delete = %d, want > %d", afterDelete, afterStore)
+		}
+	})
+
+	t.Run("Listings", func(t *testing.T) {
+		store := newStore(t)
+		seed := []leveldb.ACLTuple{
+			{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+			{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+			{Object: "doc:readme", Relation: "viewer", User: "user:bob"},
+			{Object: "doc:report", Relation: "editor", User: "user:bob"},
+			{Object: "doc:readme2", Relation: "viewer", User: "user:bob"},
+		}
+		for _, tuple := range seed {
+			mustStore(t, store, tuple)
+		}
+
+		assertTuples(t, "ListTuplesByObject", mustList(store.ListTuplesByObject("doc:readme")), []leveldb.ACLTuple{
+			{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+			{Object: "doc:readme", Relation: "viewer", User: "user:bob"},
+			{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+		})
+		assertTuples(t, "ListTuplesByObjectAndRelation", mustList(store.ListTuplesByObjectAndRelation("doc:readme", "viewer")), []leveldb.ACLTuple{
+			{Object: "doc:readme", Relation: "viewer", User: "user:bob"},
+			{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+		})
+		assertTuples(t, "ListTuplesByUser", mustList(store.ListTuplesByUser("user:bob")), []leveldb.ACLTuple{
+			{Object: "doc:readme", Relation: "viewer", User: "user:bob"},
+			{Object: "doc:readme2", Relation: "viewer", User: "user:bob"},
+			{Object: "doc:report", Relation: "editor", User: "user:bob"},
+		})
+		assertTuples(t, "ListTuplesByUserAndRelation", mustList(store.ListTuplesByUserAndRelation("user:bob", "viewer")), []leveldb.ACLTuple{
+			{Object: "doc:readme", Relation: "viewer", User: "user:bob"},
+			{Object: "doc:readme2", Relation: "viewer", User: "user:bob"},
+		})
+		assertTuples(t, "ListTuplesByUser unknown", mustList(store.ListTuplesByUser("user:nobody")), nil)
+	})
+
+	t.Run("UsersetSubjects", func(t *testing.T) {
+		store := newStore(t)
+		seed := []leveldb.ACLTuple{
+			{Object: "doc:readme", Relation: "viewer", User: "group:eng#member"},
+			{Object: "group:eng", Relation: "member", User: "user:bob"},
+			{Object: "group:eng", Relation: "member", User: "group:leads#member"},
+			{Object: "group:leads", Relation: "member", User: "user:carol"},
+		}
+		for _, tuple := range seed {
+			mustStore(t, store, tuple)
+		}
+
+		// Reverse entries of group:eng#member must not leak into object listings
+		wantGroup := []leveldb.ACLTuple{
+			{Object: "group:eng", Relation: "member", User: "group:leads#member"},
+			{Object: "group:eng", Relation: "member", User: "user:bob"},
+		}
+		assertTuples(t, "ListTuplesByObject", mustList(store.ListTuplesByObject("group:eng")), wantGroup)
+		assertTuples(t, "ListTuplesByObjectAndRelation", mustList(store.ListTuplesByObjectAndRelation("group:eng", "member")), wantGroup)
+
+		tuples, next, err := store.ListTuplesByObjectPagination("group:eng", "", 10)
+		if err != nil {
+			t.Fatalf("ListTuplesByObjectPagination: %v", err)
+		}
+		if next != "" {
+			t.Errorf("ListTuplesByObjectPagination next cursor = %q, want none", next)
+		}
+		assertTuples(t, "ListTuplesByObjectPagination", tuples, wantGroup)
+
+		// Primary entries of group:eng#member must not leak into user listings
+		wantUserset := []leveldb.ACLTuple{
+			{Object: "doc:readme", Relation: "viewer", User: "group:eng#member"},
+		}
+		assertTuples(t, "ListTuplesByUser", mustList(store.ListTuplesByUser("group:eng#member")), wantUserset)
+		assertTuples(t, "ListTuplesByUserAndRelation", mustList(store.ListTuplesByUserAndRelation("group:eng#member", "viewer")), wantUserset)
+
+		tuples, next, err = store.ListTuplesByUserPagination("group:eng#member", "", 10)
+		if err != nil {
+			t.Fatalf("ListTuplesByUserPagination: %v", err)
+		}
+		if next != "" {
+			t.Errorf("ListTuplesByUserPagination next cursor = %q, want none", next)
+		}
+		assertTuples(t, "ListTuplesByUserPagination", tuples, wantUserset)
+
+		if ok, _ := store.CheckTuple("doc:readme", "viewer", "group:eng#member"); !ok {
+			t.Errorf("CheckTuple for userset subject = false, want true")
+		}
+	})
+
+	t.Run("SeparatorsInComponents", func(t *testing.T) {
+		store := newStore(t)
+		plain := leveldb.ACLTuple{Object: "doc:a", Relation: "viewer", User: "user:x"}
+		odd := leveldb.ACLTuple{Object: "doc:a@b#c", Relation: "viewer", User: "user:x@doc:a#viewer"}
+		mustStore(t, store, plain)
+		mustStore(t, store, odd)
+
+		assertTuples(t, "ListTuplesByObject", mustList(store.ListTuplesByObject("doc:a")), []leveldb.ACLTuple{plain})
+		assertTuples(t, "ListTuplesByObject with separators", mustList(store.ListTuplesByObject("doc:a@b#c")), []leveldb.ACLTuple{odd})
+		assertTuples(t, "ListTuplesByUser", mustList(store.ListTuplesByUser("user:x")), []leveldb.ACLTuple{plain})
+		assertTuples(t, "ListTuplesByUser with separators", mustList(store.ListTuplesByUser("user:x@doc:a#viewer")), []leveldb.ACLTuple{odd})
+
+		// Tuples whose components concatenate to the same string are distinct
+		left := leveldb.ACLTuple{Object: "doc:b#c", Relation: "d", User: "user:u"}
+		right := leveldb.ACLTuple{Object: "doc:b", Relation: "c#d", User: "user:u"}
+		mustStore(t, store, left)
+		mustStore(t, store, right)
+		assertTuples(t, "ListTuplesByObject of concatenation", mustList(store.ListTuplesByObject("doc:b#c")), []leveldb.ACLTuple{left})
+		assertTuples(t, "ListTuplesByObject of concatenation", mustList(store.ListTuplesByObject("doc:b")), []leveldb.ACLTuple{right})
+		store.DeleteTuple(right.Object, right.Relation, right.User)
+		if ok, _ := store.CheckTuple(left.Object, left.Relation, left.User); !ok {
+			t.Errorf("CheckTuple after deleting a tuple with the same concatenation = false, want true")
+		}
+
+		// Components order before their extensions, whatever the separators
+		extended := leveldb.ACLTuple{Object: "doc:a!", Relation: "viewer", User: "user:x"}
+		mustStore(t, store, extended)
+		assertTuples(t, "ListTuplesByUser order", mustList(store.ListTuplesByUser("user:x")), []leveldb.ACLTuple{plain, extended})
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		store := newStore(t)
+		users := []string{"user:a", "user:b", "user:c", "user:d", "user:e"}
+		for _, user := range users {
+			mustStore(t, store, leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: user})
+			mustStore(t, store, leveldb.ACLTuple{Object: "doc:" + user[5:], Relation: "viewer", User: "user:bob"})
+		}
+
+		// Walk the pages of both listings, including the exact fit of the
+		// last page, which must not report another page
+		for _, pageSize := range []int{2, 5, 10} {
+			var got []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > len(users) {
+					t.Fatalf("ListTuplesByObjectPagination(%d) does not terminate", pageSize)
+				}
+				tuples, next, err := store.ListTuplesByObjectPagination("doc:readme", cursor, pageSize)
+				if err != nil {
+					t.Fatalf("ListTuplesByObjectPagination: %v", err)
+				}
+				if len(tuples) > pageSize || (next != "" && len(tuples) != pageSize) {
+					t.Errorf("ListTuplesByObjectPagination(%d) page = %v, next %q", pageSize, tuples, next)
+				}
+				for _, tuple := range tuples {
+					got = append(got, tuple.User)
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			if !reflect.DeepEqual(got, users) {
+				t.Errorf("ListTuplesByObjectPagination(%d) pages = %v, want %v", pageSize, got, users)
+			}
+		}
+
+		tuples, next, err := store.ListTuplesByUserPagination("user:bob", "", 3)
+		if err != nil || next == "" {
+			t.Fatalf("ListTuplesByUserPagination = %v, %q, %v, want a next cursor", tuples, next, err)
+		}
+		tuples, next, err = store.ListTuplesByUserPagination("user:bob", next, 3)
+		if err != nil {
+			t.Fatalf("ListTuplesByUserPagination: %v", err)
+		}
+		if next != "" {
+			t.Errorf("ListTuplesByUserPagination next cursor = %q, want none", next)
+		}
+		assertTuples(t, "ListTuplesByUserPagination", tuples, []leveldb.ACLTuple{
+			{Object: "doc:d", Relation: "viewer", User: "user:bob"},
+			{Object: "doc:e", Relation: "viewer", User: "user:bob"},
+		})
+
+		if _, _, err := store.ListTuplesByObjectPagination("doc:readme", "not a cursor!", 2); !errors.Is(err, leveldb.ErrInvalidCursor) {
+			t.Errorf("ListTuplesByObjectPagination with malformed cursor = %v, want ErrInvalidCursor", err)
+		}
+		// A cursor must not move a listing onto another object's tuples
+		_, foreign, _ := store.ListTuplesByObjectPagination("doc:readme", "", 2)
+		if _, _, err := store.ListTuplesByObjectPagination("doc:a", foreign, 2); !errors.Is(err, leveldb.ErrInvalidCursor) {
+			t.Errorf("ListTuplesByObjectPagination with another object's cursor = %v, want ErrInvalidCursor", err)
+		}
+	})
+
+	t.Run("Snapshots", func(t *testing.T) {
+		store := newStore(t)
+		alice := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+		bob := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:bob"}
+
+		empty := mustRevision(t, store)
+		mustStore(t, store, alice)
+		withAlice := mustRevision(t, store)
+		mustStore(t, store, bob)
+		withBoth := mustRevision(t, store)
+		if err := store.DeleteTuple(alice.Object, alice.Relation, alice.User); err != nil {
+			t.Fatalf("DeleteTuple: %v", err)
+		}
+
+		assertTuples(t, "ListTuplesByObject at empty revision", mustList(mustSnapshot(t, store, empty).ListTuplesByObject("doc:readme")), nil)
+		assertTuples(t, "ListTuplesByObject after first store", mustList(mustSnapshot(t, store, withAlice).ListTuplesByObject("doc:readme")), []leveldb.ACLTuple{alice})
+		assertTuples(t, "ListTuplesByObjectAndRelation before delete", mustList(mustSnapshot(t, store, withBoth).ListTuplesByObjectAndRelation("doc:readme", "viewer")), []leveldb.ACLTuple{alice, bob})
+		assertTuples(t, "ListTuplesByUser before delete", mustList(mustSnapshot(t, store, withBoth).ListTuplesByUser("user:alice")), []leveldb.ACLTuple{alice})
+
+		latest := mustSnapshot(t, store, mustRevision(t, store))
+		if found, err := latest.CheckTuple(alice.Object, alice.Relation, alice.User); err != nil || found {
+			t.Errorf("CheckTuple(alice) after delete = %v, %v, want false", found, err)
+		}
+		assertTuples(t, "ListTuplesByUserAndRelation after delete", mustList(latest.ListTuplesByUserAndRelation("user:bob", "viewer")), []leveldb.ACLTuple{bob})
+
+		if _, err := store.Snapshot(mustRevision(t, store) + 1); !errors.Is(err, leveldb.ErrFutureRevision) {
+			t.Errorf("Snapshot of a future revision: err = %v, want ErrFutureRevision", err)
+		}
+	})
+
+	t.Run("GarbageCollect", func(t *testing.T) {
+		store := newStore(t)
+		alice := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+		bob := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:bob"}
+
+		mustStore(t, store, alice)
+		withAlice := mustRevision(t, store)
+		if err := store.DeleteTuple(alice.Object, alice.Relation, alice.User); err != nil {
+			t.Fatalf("DeleteTuple: %v", err)
+		}
+		mustStore(t, store, bob)
+
+		if removed, err := store.GarbageCollect(time.Hour); err != nil || removed != 0 {
+			t.Errorf("GarbageCollect within retention = %d, %v, want 0", removed, err)
+		}
+		mustSnapshot(t, store, withAlice)
+
+		// Both versions of alice's tuple are gone; bob's only version stays
+		if removed, err := store.GarbageCollect(0); err != nil || removed != 2 {
+			t.Errorf("GarbageCollect = %d, %v, want 2", removed, err)
+		}
+		if _, err := store.Snapshot(withAlice); !errors.Is(err, leveldb.ErrSnapshotExpired) {
+			t.Errorf("Snapshot of a collected revision: err = %v, want ErrSnapshotExpired", err)
+		}
+		assertTuples(t, "ListTuplesByObject after GarbageCollect", mustList(mustSnapshot(t, store, mustRevision(t, store)).ListTuplesByObject("doc:readme")), []leveldb.ACLTuple{bob})
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		store := newStore(t)
+		alice := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:alice"}
+		bob := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:bob"}
+
+		start := mustRevision(t, store)
+		changed := store.Changed()
+		mustStore(t, store, alice)
+		select {
+		case <-changed:
+		default:
+			t.Errorf("Changed was not closed by a commit")
+		}
+
+		mustStore(t, store, bob)
+		if err := store.DeleteTuple(alice.Object, alice.Relation, alice.User); err != nil {
+			t.Fatalf("DeleteTuple: %v", err)
+		}
+
+		changeSets, err := store.ReadChanges(start, 0)
+		if err != nil {
+			t.Fatalf("ReadChanges: %v", err)
+		}
+		want := []leveldb.ChangeSet{
+			{Revision: start + 1, Changes: []leveldb.Change{{Operation: leveldb.OperationTouch, Tuple: alice}}},
+			{Revision: start + 2, Changes: []leveldb.Change{{Operation: leveldb.OperationTouch, Tuple: bob}}},
+			{Revision: start + 3, Changes: []leveldb.Change{{Operation: leveldb.OperationDelete, Tuple: alice}}},
+		}
+		if !reflect.DeepEqual(changeSets, want) {
+			t.Errorf("ReadChanges = %v, want %v", changeSets, want)
+		}
+
+		// Resuming from a revision returns only what follows it
+		changeSets, err = store.ReadChanges(start+1, 1)
+		if err != nil {
+			t.Fatalf("ReadChanges: %v", err)
+		}
+		if !reflect.DeepEqual(changeSets, want[1:2]) {
+			t.Errorf("ReadChanges after first revision = %v, want %v", changeSets, want[1:2])
+		}
+
+		if _, err := store.ReadChanges(start+4, 0); !errors.Is(err, leveldb.ErrFutureRevision) {
+			t.Errorf("ReadChanges from a future revision: err = %v, want ErrFutureRevision", err)
+		}
+		if _, err := store.GarbageCollect(0); err != nil {
+			t.Fatalf("GarbageCollect: %v", err)
+		}
+		if _, err := store.ReadChanges(start, 0); !errors.Is(err, leveldb.ErrSnapshotExpired) {
+			t.Errorf("ReadChanges from a collected revision: err = %v, want ErrSnapshotExpired", err)
+		}
+		if changeSets, err := store.ReadChanges(start+3, 0); err != nil || len(changeSets) != 0 {
+			t.Errorf("ReadChanges from the latest revision = %v, %v, want none", changeSets, err)
+		}
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		store := newStore(t)
+		editor := leveldb.ACLTuple{Object: "doc:readme", Relation: "editor", User: "user:bob"}
+		viewer := leveldb.ACLTuple{Object: "doc:readme", Relation: "viewer", User: "user:bob"}
+		mustStore(t, store, editor)
+		revision := mustRevision(t, store)
+
+		// Demote bob from editor to viewer in one revision
+		err := store.Write([]leveldb.Change{
+			{Operation: leveldb.OperationDelete, Tuple: editor},
+			{Operation: leveldb.OperationCreate, Tuple: viewer},
+		}, []leveldb.Precondition{
+			{Condition: leveldb.ConditionMustExist, Tuple: editor},
+		})
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if got := mustRevision(t, store); got != revision+1 {
+			t.Errorf("revision after Write = %d, want %d", got, revision+1)
+		}
+		assertTuples(t, "ListTuplesByUser after Write", mustList(store.ListTuplesByUser("user:bob")), []leveldb.ACLTuple{viewer})
+
+		changeSets, err := store.ReadChanges(revision, 0)
+		if err != nil {
+			t.Fatalf("ReadChanges: %v", err)
+		}
+		want := []leveldb.ChangeSet{{Revision: revision + 1, Changes: []leveldb.Change{
+			{Operation: leveldb.OperationDelete, Tuple: editor},
+			{Operation: leveldb.OperationTouch, Tuple: viewer},
+		}}}
+		if !reflect.DeepEqual(changeSets, want) {
+			t.Errorf("ReadChanges = %v, want %v", changeSets, want)
+		}
+
+		// Failed preconditions and creates of existing tuples write nothing
+		failing := []struct {
+			name          string
+			changes       []leveldb.Change
+			preconditions []leveldb.Precondition
+		}{
+			{"must_exist", []leveldb.Change{{Operation: leveldb.OperationDelete, Tuple: viewer}}, []leveldb.Precondition{{Condition: leveldb.ConditionMustExist, Tuple: editor}}},
+			{"must_not_exist", []leveldb.Change{{Operation: leveldb.OperationDelete, Tuple: viewer}}, []leveldb.Precondition{{Condition: leveldb.ConditionMustNotExist, Tuple: viewer}}},
+			{"create existing", []leveldb.Change{{Operation: leveldb.OperationTouch, Tuple: editor}, {Operation: leveldb.OperationCreate, Tuple: viewer}}, nil},
+		}
+		for _, tc := range failing {
+			if err := store.Write(tc.changes, tc.preconditions); !errors.Is(err, leveldb.ErrPreconditionFailed) {
+				t.Errorf("Write %s: err = %v, want ErrPreconditionFailed", tc.name, err)
+			}
+		}
+		// Changing a tuple twice is ambiguous, whatever the operations
+		for _, operations := range [][2]string{
+			{leveldb.OperationTouch, leveldb.OperationDelete},
+			{leveldb.OperationDelete, leveldb.OperationCreate},
+			{leveldb.OperationTouch, leveldb.OperationTouch},
+		} {
+			changes := []leveldb.Change{{Operation: operations[0], Tuple: editor}, {Operation: operations[1], Tuple: editor}}
+			if err := store.Write(changes, nil); !errors.Is(err, leveldb.ErrDuplicateChange) {
+				t.Errorf("Write %s and %s of one tuple: err = %v, want ErrDuplicateChange", operations[0], operations[1], err)
+			}
+		}
+		if got := mustRevision(t, store); got != revision+1 {
+			t.Errorf("revision after failed writes = %d, want %d", got, revision+1)
+		}
+		assertTuples(t, "ListTuplesByUser after failed writes", mustList(store.ListTuplesByUser("user:bob")), []leveldb.ACLTuple{viewer})
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		store := newStore(t)
+		var (
+			alice2024   = leveldb.ACLTuple{Object: "doc:2024-a", Relation: "viewer", User: "user:alice"}
+			group2024   = leveldb.ACLTuple{Object: "doc:2024-a", Relation: "viewer", User: "group:eng#member"}
+			bob2024     = leveldb.ACLTuple{Object: "doc:2024-b", Relation: "editor", User: "user:bob"}
+			alice2023   = leveldb.ACLTuple{Object: "doc:2023-c", Relation: "editor", User: "user:alice"}
+			aliceFolder = leveldb.ACLTuple{Object: "folder:x", Relation: "viewer", User: "user:alice"}
+		)
+		for _, tuple := range []leveldb.ACLTuple{alice2024, group2024, bob2024, alice2023, aliceFolder} {
+			mustStore(t, store, tuple)
+		}
+
+		for _, tc := range []struct {
+			name   string
+			filter leveldb.TupleFilter
+			want   []leveldb.ACLTuple
+		}{
+			{"namespace and relation", leveldb.TupleFilter{Namespace: "doc", Relation: "editor"}, []leveldb.ACLTuple{alice2023, bob2024}},
+			{"object id prefix", leveldb.TupleFilter{Namespace: "doc", ObjectIDPrefix: "2024-"}, []leveldb.ACLTuple{group2024, alice2024, bob2024}},
+			{"object and relation", leveldb.TupleFilter{Namespace: "doc", ObjectID: "2024-a", Relation: "viewer"}, []leveldb.ACLTuple{group2024, alice2024}},
+			{"subject", leveldb.TupleFilter{SubjectType: "user", SubjectID: "alice"}, []leveldb.ACLTuple{alice2023, alice2024, aliceFolder}},
+			{"subject and relation", leveldb.TupleFilter{SubjectType: "user", SubjectID: "alice", Relation: "viewer"}, []leveldb.ACLTuple{alice2024, aliceFolder}},
+			{"subject and namespace", leveldb.TupleFilter{Namespace: "doc", SubjectType: "user", SubjectID: "alice"}, []leveldb.ACLTuple{alice2023, alice2024}},
+			{"subject, relation and object id prefix", leveldb.TupleFilter{Namespace: "doc", ObjectIDPrefix: "2024-", Relation: "viewer", SubjectType: "user", SubjectID: "alice"}, []leveldb.ACLTuple{alice2024}},
+			{"subject type", leveldb.TupleFilter{SubjectType: "group"}, []leveldb.ACLTuple{group2024}},
+			{"relation", leveldb.TupleFilter{Relation: "viewer"}, []leveldb.ACLTuple{group2024, alice2024, aliceFolder}},
+			{"no match", leveldb.TupleFilter{Namespace: "do"}, nil},
+		} {
+			tuples, next := mustQuery(t, store, tc.filter, "", 10)
+			if next != "" {
+				t.Errorf("QueryTuples(%s) next cursor = %q, want none", tc.name, next)
+			}
+			assertTuples(t, "QueryTuples("+tc.name+")", tuples, tc.want)
+		}
+
+		filter := leveldb.TupleFilter{Namespace: "doc"}
+		first, next := mustQuery(t, store, filter, "", 3)
+		if len(first) != 3 || next == "" {
+			t.Fatalf("QueryTuples first page = %v, next %q, want 3 tuples and a next cursor", first, next)
+		}
+		cursor := next
+		second, next := mustQuery(t, store, filter, cursor, 3)
+		if next != "" {
+			t.Errorf("QueryTuples second page next cursor = %q, want none", next)
+		}
+		assertTuples(t, "QueryTuples pages", append(first, second...), []leveldb.ACLTuple{alice2023, group2024, alice2024, bob2024})
+
+		// A cursor only continues the query it came from
+		if _, err := store.QueryTuples(leveldb.TupleFilter{Namespace: "folder"}, cursor, 3, func(leveldb.ACLTuple) error { return nil }); !errors.Is(err, leveldb.ErrInvalidCursor) {
+			t.Errorf("QueryTuples with another query's cursor error = %v, want ErrInvalidCursor", err)
+		}
+
+		if _, err := store.QueryTuples(leveldb.TupleFilter{ObjectID: "2024-a"}, "", 10, func(leveldb.ACLTuple) error { return nil }); err == nil {
+			t.Errorf("QueryTuples with object id but no namespace succeeded, want an error")
+		}
+	})
+}
+
+func mustSnapshot(t *testing.T, store database.TupleStore, revision uint64) database.TupleReader {
+	t.Helper()
+	snapshot, err := store.Snapshot(revision)
+	if err != nil {
+		t.Fatalf("Snapshot(%d): %v", revision, err)
+	}
+	return snapshot
+}
+
+func mustQuery(t *testing.T, store database.TupleStore, filter leveldb.TupleFilter, cursor string, pageSize int) ([]leveldb.ACLTuple, string) {
+	t.Helper()
+	var tuples []leveldb.ACLTuple
+	next, err := store.QueryTuples(filter, cursor, pageSize, func(tuple leveldb.ACLTuple) error {
+		tuples = append(tuples, tuple)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("QueryTuples: %v", err)
+	}
+	return tuples, next
+}
+
+func mustStore(t *testing.T, store database.TupleStore, tuple leveldb.ACLTuple) {
+	t.Helper()
+	if err := store.StoreTuple(tuple); err != nil {
+		t.Fatalf("StoreTuple(%v): %v", tuple, err)
+	}
+}
+
+func mustRevision(t *testing.T, store database.TupleStore) uint64 {
+	t.Helper()
+	revision, err := store.Revision()
+	if err != nil {
+		t.Fatalf("Revision: %v", err)
+	}
+	return revision
+}
+
+func mustList(tuples []leveldb.ACLTuple, err error) []leveldb.ACLTuple {
+	if err != nil {
+		panic(err)
+	}
+	return tuples
+}
+
+func assertTuples(t *testing.T, name string, got, want []leveldb.ACLTuple) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
@@ -0,0 +1,363 @@
+// Package engine evaluates authorization checks against a tuple store and
+// the namespace configurations that define how relations are computed.
+// It has no HTTP dependencies so it can be embedded in other services.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+// DefaultMaxDepth is the recursion depth used when none is configured
+const DefaultMaxDepth = 25
+
+// ErrMaxDepthExceeded is returned when evaluating a check needs more nested
+// steps than the configured maximum depth
+var ErrMaxDepthExceeded = errors.New("max depth exceeded")
+
+// Checker evaluates whether a subject has a relation to an object
+type Checker struct {
+	tuples     database.TupleReader
+	namespaces database.NamespaceStore
+	maxDepth   int
+}
+
+// NewChecker creates a new Checker over the given tuple and namespace stores.
+// maxDepth bounds how deeply rewrites and usersets are followed; zero or a
+// negative value selects DefaultMaxDepth.
+func NewChecker(tuples database.TupleReader, namespaces database.NamespaceStore, maxDepth int) *Checker {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	return &Checker{
+		tuples:     tuples,
+		namespaces: namespaces,
+		maxDepth:   maxDepth,
+	}
+}
+
+// request tracks the state of a single top-level check
+type request struct {
+	// tuples is the tuple store seen by this check, including any
+	// contextual tuples
+	tuples database.TupleReader
+	depth  int
+	// path holds the object#relation@subject nodes currently being
+	// evaluated, so rewrite and tuple cycles are cut instead of recursing
+	// forever
+	path map[string]bool
+	// cuts counts the cycles cut so far. A result reached after a cut
+	// depends on the path that led to it and must not be memoized: a cut
+	// branch is false, which an exclusion can turn into true.
+	cuts int
+	memo *Memo
+	// trace is the trace node steps are currently added to, or nil if the
+	// check is not explained, and parents the steps enclosing it
+	trace   *TraceNode
+	parents []*TraceNode
+}
+
+// CheckOptions controls how a single check is evaluated
+type CheckOptions struct {
+	// Memo, if set, shares the results of intermediate steps between
+	// checks, e.g. the items of a batch
+	Memo *Memo
+	// ContextualTuples are evaluated as if they were stored, for this
+	// check only
+	ContextualTuples []leveldb.ACLTuple
+	// Tuples, if set, is read instead of the checker's store, e.g. a
+	// snapshot to evaluate the check at an earlier revision
+	Tuples database.TupleReader
+}
+
+// Check reports whether subject has relation to object, following the
+// rewrite rules configured for the object's namespace. It returns
+// ErrMaxDepthExceeded if the evaluation nests deeper than the maximum depth.
+func (c *Checker) Check(ctx context.Context, object, relation, subject string) (bool, error) {
+	return c.CheckWithOptions(ctx, object, relation, subject, CheckOptions{})
+}
+
+// CheckWithOptions is like Check but evaluates the check with opts
+func (c *Checker) CheckWithOptions(ctx context.Context, object, relation, subject string, opts CheckOptions) (bool, error) {
+	req := c.newRequest(opts)
+	return c.check(ctx, req, object, relation, subject)
+}
+
+// Explain is like CheckWithOptions but also returns the trace of every step
+// taken to reach the decision. The trace is returned even if the check fails
+// with an error, up to the step that failed.
+func (c *Checker) Explain(ctx context.Context, object, relation, subject string, opts CheckOptions) (bool, *TraceNode, error) {
+	root := &TraceNode{}
+	req := c.newRequest(opts)
+	req.trace = root
+
+	authorized, err := c.check(ctx, req, object, relation, subject)
+	return authorized, root.Children[0], err
+}
+
+// newRequest creates the state of a top-level check evaluated with opts
+func (c *Checker) newRequest(opts CheckOptions) *request {
+	req := &request{
+		tuples: c.tuples,
+		path:   make(map[string]bool),
+		memo:   opts.Memo,
+	}
+	if opts.Tuples != nil {
+		req.tuples = opts.Tuples
+	}
+	if len(opts.ContextualTuples) > 0 {
+		req.tuples = database.NewOverlay(req.tuples, opts.ContextualTuples)
+	}
+	return req
+}
+
+// check evaluates object#relation@subject as one step of req
+func (c *Checker) check(ctx context.Context, req *request, object, relation, subject string) (bool, error) {
+	step := req.begin(&TraceNode{Type: TraceCheck, Object: object, Relation: relation, Subject: subject})
+
+	if err := ctx.Err(); err != nil {
+		return false, req.fail(step, err)
+	}
+
+	// A node that is already being evaluated further up cannot grant
+	// anything the outer evaluation would not find on its own
+	node := object + "#" + relation + "@" + subject
+	if req.path[node] {
+		req.cuts++
+		return req.end(step, false, "cycle: already being evaluated"), nil
+	}
+
+	if authorized, ok := req.memo.get(node); ok {
+		if step != nil {
+			step.Memoized = true
+		}
+		return req.end(step, authorized, "memoized result"), nil
+	}
+
+	if req.depth >= c.maxDepth {
+		return false, req.fail(step, ErrMaxDepthExceeded)
+	}
+
+	req.path[node] = true
+	req.depth++
+	defer func() {
+		delete(req.path, node)
+		req.depth--
+	}()
+
+	rewrite, err := c.rewrite(object, relation)
+	if err != nil {
+		return false, req.fail(step, err)
+	}
+	if rewrite == nil {
+		req.memo.set(node, false)
+		return req.end(step, false, "relation is not defined"), nil
+	}
+
+	cuts := req.cuts
+	authorized, err := c.checkRewrite(ctx, req, object, relation, subject, *rewrite)
+	if err != nil {
+		return false, req.fail(step, err)
+	}
+	if req.cuts == cuts {
+		req.memo.set(node, authorized)
+	}
+	return req.end(step, authorized, ""), nil
+}
+
+// checkRewrite evaluates a single rewrite node for object#relation@subject.
+// Set operations stop as soon as their outcome is known.
+func (c *Checker) checkRewrite(ctx context.Context, req *request, object, relation, subject string, node consul.UnionConfig) (bool, error) {
+	switch {
+	case node.This != nil:
+		return c.checkThis(ctx, req, object, relation, subject)
+
+	case node.ComputedUserset != nil:
+		// The computed userset is object#computed_relation on the same
+		// object, so the check is simply re-evaluated for that relation
+		step := req.begin(&TraceNode{Type: TraceComputedUserset, Relation: node.ComputedUserset.Relation})
+		authorized, err := c.check(ctx, req, object, node.ComputedUserset.Relation, subject)
+		if err != nil {
+			return false, req.fail(step, err)
+		}
+		return req.end(step, authorized, ""), nil
+
+	case node.TupleToUserset != nil:
+		return c.checkTupleToUserset(ctx, req, object, subject, node.TupleToUserset)
+
+	case len(node.Union) > 0:
+		step := req.begin(&TraceNode{Type: TraceUnion})
+		for i, child := range node.Union {
+			authorized, err := c.checkRewrite(ctx, req, object, relation, subject, child)
+			if err != nil {
+				return false, req.fail(step, err)
+			}
+			if authorized {
+				return req.end(step, true, fmt.Sprintf("child %d granted", i)), nil
+			}
+		}
+		return req.end(step, false, "no child granted"), nil
+
+	case len(node.Intersection) > 0:
+		step := req.begin(&TraceNode{Type: TraceIntersection})
+		for i, child := range node.Intersection {
+			authorized, err := c.checkRewrite(ctx, req, object, relation, subject, child)
+			if err != nil {
+				return false, req.fail(step, err)
+			}
+			if !authorized {
+				return req.end(step, false, fmt.Sprintf("child %d denied", i)), nil
+			}
+		}
+		return req.end(step, true, "all children granted"), nil
+
+	case node.Exclusion != nil:
+		step := req.begin(&TraceNode{Type: TraceExclusion})
+		authorized, err := c.checkRewrite(ctx, req, object, relation, subject, node.Exclusion.Base)
+		if err != nil {
+			return false, req.fail(step, err)
+		}
+		if !authorized {
+			return req.end(step, false, "base denied"), nil
+		}
+		excluded, err := c.checkRewrite(ctx, req, object, relation, subject, node.Exclusion.Subtract)
+		if err != nil {
+			return false, req.fail(step, err)
+		}
+		if excluded {
+			return req.end(step, false, "subtract granted"), nil
+		}
+		return req.end(step, true, "base granted and subtract denied"), nil
+
+	default:
+		return false, nil
+	}
+}
+
+// checkTupleToUserset follows the tuples stored under object#tupleset to the
+// objects they reference, e.g. doc:readme#parent@folder:eng, and checks the
+// computed relation on each of them, e.g. folder:eng#viewer
+func (c *Checker) checkTupleToUserset(ctx context.Context, req *request, object, subject string, ttu *consul.TupleToUsersetConfig) (bool, error) {
+	step := req.begin(&TraceNode{Type: TraceTupleToUserset, Relation: ttu.ComputedUserset.Relation, Tupleset: ttu.Tupleset.Relation})
+
+	tuples, err := req.tuples.ListTuplesByObjectAndRelation(object, ttu.Tupleset.Relation)
+	if err != nil {
+		return false, req.fail(step, fmt.Errorf("failed to list tupleset: %v", err))
+	}
+	req.lookup(object, ttu.Tupleset.Relation, tuples)
+
+	for _, tuple := range tuples {
+		target := tuple.User
+		if usersetObject, _, ok := ParseUserset(tuple.User); ok {
+			target = usersetObject
+		}
+
+		authorized, err := c.check(ctx, req, target, ttu.ComputedUserset.Relation, subject)
+		if err != nil {
+			return false, req.fail(step, err)
+		}
+		if authorized {
+			return req.end(step, true, "granted on "+target), nil
+		}
+	}
+
+	return req.end(step, false, "no referenced object granted"), nil
+}
+
+// checkThis evaluates the tuples stored directly under object#relation.
+// Besides a tuple naming the subject itself, a tuple whose user is a userset
+// such as group:eng#member grants the relation to every member of that
+// userset, so those are expanded recursively.
+func (c *Checker) checkThis(ctx context.Context, req *request, object, relation, subject string) (bool, error) {
+	step := req.begin(&TraceNode{Type: TraceThis})
+
+	authorized, err := req.tuples.CheckTuple(object, relation, subject)
+	if err != nil {
+		return false, req.fail(step, fmt.Errorf("failed to check direct tuple: %v", err))
+	}
+	req.lookupTuple(object, relation, subject, authorized)
+	if authorized {
+		return req.end(step, true, "direct tuple found"), nil
+	}
+
+	tuples, err := req.tuples.ListTuplesByObjectAndRelation(object, relation)
+	if err != nil {
+		return false, req.fail(step, fmt.Errorf("failed to list tuples: %v", err))
+	}
+	req.lookup(object, relation, tuples)
+
+	for _, tuple := range tuples {
+		usersetObject, usersetRelation, ok := ParseUserset(tuple.User)
+		if !ok {
+			continue
+		}
+
+		authorized, err := c.check(ctx, req, usersetObject, usersetRelation, subject)
+		if err != nil {
+			return false, req.fail(step, err)
+		}
+		if authorized {
+			return req.end(step, true, "granted through "+tuple.User), nil
+		}
+	}
+
+	return req.end(step, false, "no direct tuple or userset granted"), nil
+}
+
+// rewrite returns the root rewrite node for object#relation. A relation with
+// no rules, and any relation of an object whose namespace has no
+// configuration, is treated as a plain "this": only direct tuples grant it.
+// A relation the namespace does not define has no rewrite and grants nothing.
+func (c *Checker) rewrite(object, relation string) (*consul.UnionConfig, error) {
+	direct := &consul.UnionConfig{This: &consul.ThisConfig{}}
+
+	namespace, ok := namespaceOf(object)
+	if !ok {
+		return direct, nil
+	}
+
+	exists, err := c.namespaces.NamespaceExists(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check namespace: %v", err)
+	}
+	if !exists {
+		return direct, nil
+	}
+
+	config, err := c.namespaces.GetNamespace(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace config: %v", err)
+	}
+
+	relationConfig, exists := config.Relations[relation]
+	if !exists {
+		return nil, nil
+	}
+
+	switch {
+	case len(relationConfig.Union) > 0:
+		return &consul.UnionConfig{Union: relationConfig.Union}, nil
+	case len(relationConfig.Intersection) > 0:
+		return &consul.UnionConfig{Intersection: relationConfig.Intersection}, nil
+	case relationConfig.Exclusion != nil:
+		return &consul.UnionConfig{Exclusion: relationConfig.Exclusion}, nil
+	default:
+		return direct, nil
+	}
+}
+
+// namespaceOf extracts the namespace from an object in the format namespace:object_id
+func namespaceOf(object string) (string, bool) {
+	parts := strings.Split(object, ":")
+	if len(parts) != 2 {
+		return "", false
+	}
+	return parts[0], true
+}
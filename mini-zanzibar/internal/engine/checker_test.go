@@ -0,0 +1,509 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"mini-zanzibar/internal/database"
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/leveldb"
+	"mini-zanzibar/internal/database/memory"
+)
+
+// docNamespace is the owner > editor > viewer example from the project brief
+var docNamespace = consul.NamespaceConfig{
+	Namespace: "doc",
+	Relations: map[string]consul.RelationConfig{
+		"owner": {},
+		"editor": {
+			Union: []consul.UnionConfig{
+				{This: &consul.ThisConfig{}},
+				{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "owner"}},
+			},
+		},
+		"viewer": {
+			Union: []consul.UnionConfig{
+				{This: &consul.ThisConfig{}},
+				{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "editor"}},
+			},
+		},
+	},
+}
+
+type checkCase struct {
+	name                   string
+	object, relation, user string
+	want                   bool
+}
+
+// newTestChecker builds a Checker over in-memory stores seeded with the
+// given namespaces and tuples
+func newTestChecker(t *testing.T, namespaces []consul.NamespaceConfig, tuples []leveldb.ACLTuple) *Checker {
+	t.Helper()
+
+	namespaceStore := memory.NewNamespaceStore()
+	for _, config := range namespaces {
+		if err := namespaceStore.StoreNamespace(config.Namespace, config); err != nil {
+			t.Fatalf("StoreNamespace(%s): %v", config.Namespace, err)
+		}
+	}
+
+	tupleStore := memory.NewTupleStore()
+	for _, tuple := range tuples {
+		if err := tupleStore.StoreTuple(tuple); err != nil {
+			t.Fatalf("StoreTuple(%v): %v", tuple, err)
+		}
+	}
+
+	return NewChecker(tupleStore, namespaceStore, 0)
+}
+
+func runCheckCases(t *testing.T, checker *Checker, cases []checkCase) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := checker.Check(context.Background(), tc.object, tc.relation, tc.user)
+			if err != nil {
+				t.Fatalf("Check(%s#%s@%s): %v", tc.object, tc.relation, tc.user, err)
+			}
+			if got != tc.want {
+				t.Errorf("Check(%s#%s@%s) = %v, want %v", tc.object, tc.relation, tc.user, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckDocNamespace(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+		{Object: "doc:readme", Relation: "editor", User: "user:bob"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+	})
+
+	runCheckCases(t, checker, []checkCase{
+		{"direct owner", "doc:readme", "owner", "user:alice", true},
+		{"owner is editor", "doc:readme", "editor", "user:alice", true},
+		{"owner is viewer", "doc:readme", "viewer", "user:alice", true},
+		{"direct editor", "doc:readme", "editor", "user:bob", true},
+		{"editor is viewer", "doc:readme", "viewer", "user:bob", true},
+		{"editor is not owner", "doc:readme", "owner", "user:bob", false},
+		{"direct viewer", "doc:readme", "viewer", "user:carol", true},
+		{"viewer is not editor", "doc:readme", "editor", "user:carol", false},
+		{"stranger", "doc:readme", "viewer", "user:dave", false},
+		{"other object", "doc:other", "viewer", "user:alice", false},
+	})
+}
+
+func TestCheckHonoursContext(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := checker.Check(ctx, "doc:readme", "viewer", "user:alice"); err == nil {
+		t.Fatalf("Check with cancelled context succeeded, want error")
+	}
+}
+
+// TestCheckNamespaceHierarchies guards against any built-in relation
+// hierarchy: results must follow the rewrites of each namespace only
+func TestCheckNamespaceHierarchies(t *testing.T) {
+	this := consul.UnionConfig{This: &consul.ThisConfig{}}
+	computed := func(relation string) consul.UnionConfig {
+		return consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: relation}}
+	}
+
+	namespaces := []consul.NamespaceConfig{
+		{
+			// Same relation names as doc, but no concentric relations at all
+			Namespace: "flat",
+			Relations: map[string]consul.RelationConfig{
+				"owner":  {},
+				"editor": {Union: []consul.UnionConfig{this}},
+				"viewer": {Union: []consul.UnionConfig{this}},
+			},
+		},
+		{
+			// viewer includes owner but skips editor
+			Namespace: "skip",
+			Relations: map[string]consul.RelationConfig{
+				"owner":  {},
+				"editor": {Union: []consul.UnionConfig{this, computed("owner")}},
+				"viewer": {Union: []consul.UnionConfig{this, computed("owner")}},
+			},
+		},
+		{
+			// Inverted hierarchy: viewer grants editor, which grants owner
+			Namespace: "inverted",
+			Relations: map[string]consul.RelationConfig{
+				"viewer": {},
+				"editor": {Union: []consul.UnionConfig{this, computed("viewer")}},
+				"owner":  {Union: []consul.UnionConfig{this, computed("editor")}},
+			},
+		},
+		{
+			// viewer is purely computed, direct viewer tuples grant nothing
+			Namespace: "computed",
+			Relations: map[string]consul.RelationConfig{
+				"editor": {},
+				"viewer": {Union: []consul.UnionConfig{computed("editor")}},
+			},
+		},
+		{
+			// Custom relation names with a three level chain
+			Namespace: "repo",
+			Relations: map[string]consul.RelationConfig{
+				"admin":      {},
+				"maintainer": {Union: []consul.UnionConfig{this, computed("admin")}},
+				"reader":     {Union: []consul.UnionConfig{this, computed("maintainer")}},
+				"triager":    {},
+			},
+		},
+	}
+
+	checker := newTestChecker(t, namespaces, []leveldb.ACLTuple{
+		{Object: "flat:a", Relation: "owner", User: "user:alice"},
+		{Object: "flat:a", Relation: "editor", User: "user:bob"},
+		{Object: "skip:a", Relation: "owner", User: "user:alice"},
+		{Object: "skip:a", Relation: "editor", User: "user:bob"},
+		{Object: "inverted:a", Relation: "viewer", User: "user:carol"},
+		{Object: "inverted:a", Relation: "owner", User: "user:alice"},
+		{Object: "computed:a", Relation: "viewer", User: "user:carol"},
+		{Object: "computed:a", Relation: "editor", User: "user:bob"},
+		{Object: "repo:a", Relation: "admin", User: "user:alice"},
+		{Object: "repo:a", Relation: "triager", User: "user:dave"},
+		{Object: "repo:a", Relation: "owner", User: "user:erin"},
+		{Object: "nsless:a", Relation: "owner", User: "user:alice"},
+	})
+
+	runCheckCases(t, checker, []checkCase{
+		{"flat owner is owner", "flat:a", "owner", "user:alice", true},
+		{"flat owner is not editor", "flat:a", "editor", "user:alice", false},
+		{"flat owner is not viewer", "flat:a", "viewer", "user:alice", false},
+		{"flat editor is not viewer", "flat:a", "viewer", "user:bob", false},
+
+		{"skip owner is viewer", "skip:a", "viewer", "user:alice", true},
+		{"skip editor is not viewer", "skip:a", "viewer", "user:bob", false},
+
+		{"inverted viewer is owner", "inverted:a", "owner", "user:carol", true},
+		{"inverted owner is not viewer", "inverted:a", "viewer", "user:alice", false},
+		{"inverted owner is not editor", "inverted:a", "editor", "user:alice", false},
+
+		{"computed direct viewer ignored", "computed:a", "viewer", "user:carol", false},
+		{"computed editor is viewer", "computed:a", "viewer", "user:bob", true},
+
+		{"repo admin is reader", "repo:a", "reader", "user:alice", true},
+		{"repo admin is not triager", "repo:a", "triager", "user:alice", false},
+		{"repo triager is not reader", "repo:a", "reader", "user:dave", false},
+		{"repo undefined relation grants nothing", "repo:a", "owner", "user:erin", false},
+
+		{"namespace without config uses direct tuples", "nsless:a", "owner", "user:alice", true},
+		{"namespace without config has no hierarchy", "nsless:a", "viewer", "user:alice", false},
+	})
+}
+
+func TestCheckUsersetSubjects(t *testing.T) {
+	groupNamespace := consul.NamespaceConfig{
+		Namespace: "group",
+		Relations: map[string]consul.RelationConfig{
+			"member": {},
+		},
+	}
+
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace, groupNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "viewer", User: "group:eng#member"},
+		{Object: "doc:readme", Relation: "owner", User: "group:admins#member"},
+		{Object: "group:eng", Relation: "member", User: "user:bob"},
+		{Object: "group:eng", Relation: "member", User: "group:leads#member"},
+		{Object: "group:leads", Relation: "member", User: "user:carol"},
+		{Object: "group:admins", Relation: "member", User: "user:erin"},
+	})
+
+	runCheckCases(t, checker, []checkCase{
+		{"group member is viewer", "doc:readme", "viewer", "user:bob", true},
+		{"nested group member is viewer", "doc:readme", "viewer", "user:carol", true},
+		{"group member is not editor", "doc:readme", "editor", "user:bob", false},
+		{"owner group member is editor", "doc:readme", "editor", "user:erin", true},
+		{"owner group member is viewer", "doc:readme", "viewer", "user:erin", true},
+		{"non member", "doc:readme", "viewer", "user:dave", false},
+		{"userset subject itself", "doc:readme", "viewer", "group:eng#member", true},
+		{"nested userset subject", "doc:readme", "viewer", "group:leads#member", true},
+		{"membership", "group:eng", "member", "user:carol", true},
+	})
+}
+
+func TestParseUserset(t *testing.T) {
+	for _, tc := range []struct {
+		subject          string
+		object, relation string
+		ok               bool
+	}{
+		{"group:eng#member", "group:eng", "member", true},
+		{"user:alice", "", "", false},
+		{"group:eng#", "", "", false},
+		{"eng#member", "", "", false},
+		{"group:eng#member#x", "", "", false},
+	} {
+		object, relation, ok := ParseUserset(tc.subject)
+		if object != tc.object || relation != tc.relation || ok != tc.ok {
+			t.Errorf("ParseUserset(%q) = %q, %q, %v, want %q, %q, %v", tc.subject, object, relation, ok, tc.object, tc.relation, tc.ok)
+		}
+	}
+}
+
+func TestCheckTupleToUserset(t *testing.T) {
+	this := consul.UnionConfig{This: &consul.ThisConfig{}}
+	parentViewer := consul.UnionConfig{TupleToUserset: &consul.TupleToUsersetConfig{
+		Tupleset:        consul.TuplesetConfig{Relation: "parent"},
+		ComputedUserset: consul.ComputedUsersetConfig{Relation: "viewer"},
+	}}
+
+	folderNamespace := consul.NamespaceConfig{
+		Namespace: "folder",
+		Relations: map[string]consul.RelationConfig{
+			"parent": {},
+			"owner":  {},
+			"viewer": {Union: []consul.UnionConfig{
+				this,
+				{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "owner"}},
+				parentViewer,
+			}},
+		},
+	}
+	fileNamespace := consul.NamespaceConfig{
+		Namespace: "file",
+		Relations: map[string]consul.RelationConfig{
+			"parent": {},
+			"viewer": {Union: []consul.UnionConfig{this, parentViewer}},
+		},
+	}
+	groupNamespace := consul.NamespaceConfig{
+		Namespace: "group",
+		Relations: map[string]consul.RelationConfig{"member": {}},
+	}
+
+	checker := newTestChecker(t, []consul.NamespaceConfig{folderNamespace, fileNamespace, groupNamespace}, []leveldb.ACLTuple{
+		{Object: "file:readme", Relation: "parent", User: "folder:eng"},
+		{Object: "folder:eng", Relation: "parent", User: "folder:root"},
+		{Object: "folder:eng", Relation: "viewer", User: "user:bob"},
+		{Object: "folder:root", Relation: "owner", User: "user:alice"},
+		{Object: "folder:root", Relation: "viewer", User: "group:all#member"},
+		{Object: "group:all", Relation: "member", User: "user:carol"},
+		{Object: "file:orphan", Relation: "viewer", User: "user:dave"},
+	})
+
+	runCheckCases(t, checker, []checkCase{
+		{"parent folder viewer", "file:readme", "viewer", "user:bob", true},
+		{"grandparent owner", "file:readme", "viewer", "user:alice", true},
+		{"grandparent group member", "file:readme", "viewer", "user:carol", true},
+		{"child viewer does not flow up", "folder:eng", "viewer", "user:dave", false},
+		{"direct viewer of orphan", "file:orphan", "viewer", "user:dave", true},
+		{"orphan has no parent", "file:orphan", "viewer", "user:bob", false},
+		{"tupleset itself grants nothing", "file:readme", "viewer", "folder:eng", false},
+	})
+}
+
+// lookupRecorder records which relations the checker reads tuples for
+type lookupRecorder struct {
+	database.TupleReader
+	relations map[string]int
+}
+
+func (r *lookupRecorder) CheckTuple(object, relation, user string) (bool, error) {
+	r.relations[relation]++
+	return r.TupleReader.CheckTuple(object, relation, user)
+}
+
+func TestCheckSetOperations(t *testing.T) {
+	computed := func(relation string) consul.UnionConfig {
+		return consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: relation}}
+	}
+
+	namespace := consul.NamespaceConfig{
+		Namespace: "doc",
+		Relations: map[string]consul.RelationConfig{
+			"editor":    {},
+			"viewer":    {},
+			"reviewer":  {},
+			"commenter": {},
+			"banned":    {},
+			// can_edit = editor AND NOT banned
+			"can_edit": {Exclusion: &consul.ExclusionConfig{
+				Base:     computed("editor"),
+				Subtract: computed("banned"),
+			}},
+			// can_review = editor AND reviewer
+			"can_review": {Intersection: []consul.UnionConfig{computed("editor"), computed("reviewer")}},
+			// can_comment = can_review OR (viewer AND (commenter AND NOT banned))
+			"can_comment": {Union: []consul.UnionConfig{
+				computed("can_review"),
+				{Intersection: []consul.UnionConfig{
+					computed("viewer"),
+					{Exclusion: &consul.ExclusionConfig{
+						Base:     computed("commenter"),
+						Subtract: computed("banned"),
+					}},
+				}},
+			}},
+		},
+	}
+
+	checker := newTestChecker(t, []consul.NamespaceConfig{namespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "editor", User: "user:alice"},
+		{Object: "doc:readme", Relation: "editor", User: "user:bob"},
+		{Object: "doc:readme", Relation: "banned", User: "user:bob"},
+		{Object: "doc:readme", Relation: "reviewer", User: "user:alice"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+		{Object: "doc:readme", Relation: "commenter", User: "user:carol"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:dave"},
+		{Object: "doc:readme", Relation: "commenter", User: "user:dave"},
+		{Object: "doc:readme", Relation: "banned", User: "user:dave"},
+		{Object: "doc:readme", Relation: "commenter", User: "user:erin"},
+	})
+
+	runCheckCases(t, checker, []checkCase{
+		{"editor can edit", "doc:readme", "can_edit", "user:alice", true},
+		{"banned editor cannot edit", "doc:readme", "can_edit", "user:bob", false},
+		{"non editor cannot edit", "doc:readme", "can_edit", "user:carol", false},
+		{"editor and reviewer can review", "doc:readme", "can_review", "user:alice", true},
+		{"editor only cannot review", "doc:readme", "can_review", "user:bob", false},
+		{"reviewer can comment", "doc:readme", "can_comment", "user:alice", true},
+		{"viewer commenter can comment", "doc:readme", "can_comment", "user:carol", true},
+		{"banned viewer commenter cannot comment", "doc:readme", "can_comment", "user:dave", false},
+		{"commenter without view cannot comment", "doc:readme", "can_comment", "user:erin", false},
+	})
+
+	t.Run("short circuit", func(t *testing.T) {
+		recorder := &lookupRecorder{TupleReader: checker.tuples, relations: map[string]int{}}
+		recording := NewChecker(recorder, checker.namespaces, 0)
+
+		if ok, err := recording.Check(context.Background(), "doc:readme", "can_edit", "user:carol"); err != nil || ok {
+			t.Fatalf("Check can_edit = %v, %v", ok, err)
+		}
+		if recorder.relations["banned"] != 0 {
+			t.Errorf("exclusion evaluated subtract although base was false")
+		}
+
+		if ok, err := recording.Check(context.Background(), "doc:readme", "can_review", "user:carol"); err != nil || ok {
+			t.Fatalf("Check can_review = %v, %v", ok, err)
+		}
+		if recorder.relations["reviewer"] != 0 {
+			t.Errorf("intersection evaluated reviewer although editor was false")
+		}
+	})
+}
+
+func TestCheckCycles(t *testing.T) {
+	computed := func(relation string) consul.UnionConfig {
+		return consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: relation}}
+	}
+	this := consul.UnionConfig{This: &consul.ThisConfig{}}
+
+	loop := consul.NamespaceConfig{
+		Namespace: "loop",
+		Relations: map[string]consul.RelationConfig{
+			"editor": {Union: []consul.UnionConfig{this, computed("viewer")}},
+			"viewer": {Union: []consul.UnionConfig{this, computed("editor")}},
+		},
+	}
+	group := consul.NamespaceConfig{
+		Namespace: "group",
+		Relations: map[string]consul.RelationConfig{"member": {}},
+	}
+
+	checker := newTestChecker(t, []consul.NamespaceConfig{loop, group}, []leveldb.ACLTuple{
+		{Object: "loop:a", Relation: "viewer", User: "user:alice"},
+		{Object: "group:a", Relation: "member", User: "group:b#member"},
+		{Object: "group:b", Relation: "member", User: "group:a#member"},
+		{Object: "group:b", Relation: "member", User: "user:bob"},
+	})
+
+	runCheckCases(t, checker, []checkCase{
+		{"rewrite cycle grants", "loop:a", "editor", "user:alice", true},
+		{"rewrite cycle denies", "loop:a", "editor", "user:bob", false},
+		{"tuple loop grants", "group:a", "member", "user:bob", true},
+		{"tuple loop denies", "group:a", "member", "user:carol", false},
+	})
+}
+
+func TestCheckMaxDepth(t *testing.T) {
+	group := consul.NamespaceConfig{
+		Namespace: "group",
+		Relations: map[string]consul.RelationConfig{"member": {}},
+	}
+
+	// group:g0 <- group:g1 <- ... <- group:g5 <- user:bob
+	var tuples []leveldb.ACLTuple
+	for i := 0; i < 5; i++ {
+		tuples = append(tuples, leveldb.ACLTuple{
+			Object:   fmt.Sprintf("group:g%d", i),
+			Relation: "member",
+			User:     fmt.Sprintf("group:g%d#member", i+1),
+		})
+	}
+	tuples = append(tuples, leveldb.ACLTuple{Object: "group:g5", Relation: "member", User: "user:bob"})
+
+	unbounded := newTestChecker(t, []consul.NamespaceConfig{group}, tuples)
+	if ok, err := unbounded.Check(context.Background(), "group:g0", "member", "user:bob"); err != nil || !ok {
+		t.Fatalf("Check with default depth = %v, %v, want true", ok, err)
+	}
+
+	shallow := NewChecker(unbounded.tuples, unbounded.namespaces, 3)
+	_, err := shallow.Check(context.Background(), "group:g0", "member", "user:bob")
+	if !errors.Is(err, ErrMaxDepthExceeded) {
+		t.Fatalf("Check with depth 3 error = %v, want ErrMaxDepthExceeded", err)
+	}
+
+	// A check that resolves within the limit is unaffected
+	if ok, err := shallow.Check(context.Background(), "group:g4", "member", "user:bob"); err != nil || !ok {
+		t.Fatalf("Check within depth 3 = %v, %v, want true", ok, err)
+	}
+}
+
+func TestCheckContextualTuples(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "editor", User: "group:eng#member"},
+	})
+
+	opts := CheckOptions{ContextualTuples: []leveldb.ACLTuple{
+		{Object: "group:eng", Relation: "member", User: "user:bob"},
+	}}
+
+	if ok, err := checker.CheckWithOptions(context.Background(), "doc:readme", "viewer", "user:bob", opts); err != nil || !ok {
+		t.Fatalf("Check with contextual tuple = %v, %v, want true", ok, err)
+	}
+
+	// The contextual tuple was never stored
+	if ok, err := checker.Check(context.Background(), "doc:readme", "viewer", "user:bob"); err != nil || ok {
+		t.Fatalf("Check without contextual tuple = %v, %v, want false", ok, err)
+	}
+	if tuples, _ := checker.tuples.ListTuplesByObject("group:eng"); len(tuples) != 0 {
+		t.Fatalf("contextual tuple was stored: %v", tuples)
+	}
+}
+
+func TestCheckAtSnapshot(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "editor", User: "user:bob"},
+	})
+
+	store := checker.tuples.(*memory.TupleStore)
+	revision, _ := store.Revision()
+	if err := store.DeleteTuple("doc:readme", "editor", "user:bob"); err != nil {
+		t.Fatalf("DeleteTuple: %v", err)
+	}
+
+	snapshot, err := store.Snapshot(revision)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	if ok, err := checker.CheckWithOptions(context.Background(), "doc:readme", "viewer", "user:bob", CheckOptions{Tuples: snapshot}); err != nil || !ok {
+		t.Fatalf("Check at revision %d = %v, %v, want true", revision, ok, err)
+	}
+	if ok, err := checker.Check(context.Background(), "doc:readme", "viewer", "user:bob"); err != nil || ok {
+		t.Fatalf("Check at latest revision = %v, %v, want false", ok, err)
+	}
+}
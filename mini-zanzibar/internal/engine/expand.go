@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"mini-zanzibar/internal/database/consul"
+)
+
+// Node types of an expanded userset tree
+const (
+	NodeUnion           = "union"
+	NodeIntersection    = "intersection"
+	NodeExclusion       = "exclusion"
+	NodeThis            = "this"
+	NodeComputedUserset = "computed_userset"
+	NodeTupleToUserset  = "tuple_to_userset"
+	// NodeUserset is an object#relation that was not expanded further,
+	// because of the depth limit or because it is already being expanded
+	NodeUserset = "userset"
+	// NodeUndefined is a relation the object's namespace does not define
+	NodeUndefined = "undefined"
+)
+
+// ExpandNode is a node of the userset tree returned by Expand. Rewrite nodes
+// mirror the namespace configuration; the subjects of "this" nodes come from
+// the stored tuples, and userset subjects are expanded as children.
+type ExpandNode struct {
+	Type     string        `json:"type"`
+	Object   string        `json:"object,omitempty"`
+	Relation string        `json:"relation,omitempty"`
+	Tupleset string        `json:"tupleset,omitempty"`
+	Subjects []string      `json:"subjects,omitempty"`
+	Children []*ExpandNode `json:"children,omitempty"`
+	// Truncated is set on userset nodes cut off by the depth limit
+	Truncated bool `json:"truncated,omitempty"`
+	// Cycle is set on userset nodes that refer back to a node being expanded
+	Cycle bool `json:"cycle,omitempty"`
+}
+
+// Expand returns the userset tree of object#relation: its rewrite rules with
+// the subjects they currently resolve to. maxDepth bounds how many nested
+// object#relation pairs are expanded; deeper ones are returned as truncated
+// userset nodes. Zero, a negative value or one above the checker's maximum
+// depth selects the checker's maximum depth.
+func (c *Checker) Expand(ctx context.Context, object, relation string, maxDepth int) (*ExpandNode, error) {
+	if maxDepth <= 0 || maxDepth > c.maxDepth {
+		maxDepth = c.maxDepth
+	}
+
+	e := &expansion{
+		checker:  c,
+		maxDepth: maxDepth,
+		req:      &request{path: make(map[string]bool)},
+	}
+	return e.expand(ctx, object, relation)
+}
+
+// expansion tracks the state of a single Expand call
+type expansion struct {
+	checker  *Checker
+	maxDepth int
+	req      *request
+}
+
+// expand builds the tree of object#relation
+func (e *expansion) expand(ctx context.Context, object, relation string) (*ExpandNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	node := object + "#" + relation
+	if e.req.path[node] {
+		return &ExpandNode{Type: NodeUserset, Object: object, Relation: relation, Cycle: true}, nil
+	}
+	if e.req.depth >= e.maxDepth {
+		return &ExpandNode{Type: NodeUserset, Object: object, Relation: relation, Truncated: true}, nil
+	}
+
+	e.req.path[node] = true
+	e.req.depth++
+	defer func() {
+		delete(e.req.path, node)
+		e.req.depth--
+	}()
+
+	rewrite, err := e.checker.rewrite(object, relation)
+	if err != nil {
+		return nil, err
+	}
+	if rewrite == nil {
+		return &ExpandNode{Type: NodeUndefined, Object: object, Relation: relation}, nil
+	}
+
+	tree, err := e.expandRewrite(ctx, object, relation, *rewrite)
+	if err != nil {
+		return nil, err
+	}
+	tree.Object = object
+	tree.Relation = relation
+	return tree, nil
+}
+
+// expandRewrite builds the tree of a single rewrite node of object#relation
+func (e *expansion) expandRewrite(ctx context.Context, object, relation string, rewrite consul.UnionConfig) (*ExpandNode, error) {
+	switch {
+	case rewrite.This != nil:
+		return e.expandThis(ctx, object, relation)
+
+	case rewrite.ComputedUserset != nil:
+		child, err := e.expand(ctx, object, rewrite.ComputedUserset.Relation)
+		if err != nil {
+			return nil, err
+		}
+		return &ExpandNode{
+			Type:     NodeComputedUserset,
+			Relation: rewrite.ComputedUserset.Relation,
+			Children: []*ExpandNode{child},
+		}, nil
+
+	case rewrite.TupleToUserset != nil:
+		return e.expandTupleToUserset(ctx, object, rewrite.TupleToUserset)
+
+	case len(rewrite.Union) > 0:
+		return e.expandChildren(ctx, NodeUnion, object, relation, rewrite.Union)
+
+	case len(rewrite.Intersection) > 0:
+		return e.expandChildren(ctx, NodeIntersection, object, relation, rewrite.Intersection)
+
+	case rewrite.Exclusion != nil:
+		children := []consul.UnionConfig{rewrite.Exclusion.Base, rewrite.Exclusion.Subtract}
+		return e.expandChildren(ctx, NodeExclusion, object, relation, children)
+
+	default:
+		return &ExpandNode{Type: NodeUnion}, nil
+	}
+}
+
+// expandChildren builds a set operation node from its children in order
+func (e *expansion) expandChildren(ctx context.Context, nodeType, object, relation string, children []consul.UnionConfig) (*ExpandNode, error) {
+	tree := &ExpandNode{Type: nodeType}
+	for _, child := range children {
+		node, err := e.expandRewrite(ctx, object, relation, child)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, node)
+	}
+	return tree, nil
+}
+
+// expandThis lists the tuples stored under object#relation. Plain subjects
+// are leaves; userset subjects are expanded as children.
+func (e *expansion) expandThis(ctx context.Context, object, relation string) (*ExpandNode, error) {
+	tuples, err := e.checker.tuples.ListTuplesByObjectAndRelation(object, relation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tuples: %v", err)
+	}
+
+	tree := &ExpandNode{Type: NodeThis}
+	for _, tuple := range tuples {
+		usersetObject, usersetRelation, ok := ParseUserset(tuple.User)
+		if !ok {
+			tree.Subjects = append(tree.Subjects, tuple.User)
+			continue
+		}
+
+		child, err := e.expand(ctx, usersetObject, usersetRelation)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, child)
+	}
+	return tree, nil
+}
+
+// expandTupleToUserset expands the computed relation on every object
+// referenced from object#tupleset
+func (e *expansion) expandTupleToUserset(ctx context.Context, object string, ttu *consul.TupleToUsersetConfig) (*ExpandNode, error) {
+	tuples, err := e.checker.tuples.ListTuplesByObjectAndRelation(object, ttu.Tupleset.Relation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tupleset: %v", err)
+	}
+
+	tree := &ExpandNode{
+		Type:     NodeTupleToUserset,
+		Relation: ttu.ComputedUserset.Relation,
+		Tupleset: ttu.Tupleset.Relation,
+	}
+	for _, tuple := range tuples {
+		target := tuple.User
+		if usersetObject, _, ok := ParseUserset(tuple.User); ok {
+			target = usersetObject
+		}
+
+		child, err := e.expand(ctx, target, ttu.ComputedUserset.Relation)
+		if err != nil {
+			return nil, err
+		}
+		tree.Children = append(tree.Children, child)
+	}
+	return tree, nil
+}
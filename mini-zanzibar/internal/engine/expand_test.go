@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+// assertTree compares trees through their JSON form so failures are readable
+func assertTree(t *testing.T, got *ExpandNode, want string) {
+	t.Helper()
+
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("marshal tree: %v", err)
+	}
+
+	var wantTree ExpandNode
+	if err := json.Unmarshal([]byte(want), &wantTree); err != nil {
+		t.Fatalf("unmarshal want: %v", err)
+	}
+	wantJSON, _ := json.Marshal(&wantTree)
+
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("tree =\n%s\nwant\n%s", gotJSON, wantJSON)
+	}
+}
+
+func TestExpandDocNamespace(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+		{Object: "doc:readme", Relation: "editor", User: "group:eng#member"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+		{Object: "group:eng", Relation: "member", User: "user:bob"},
+	})
+
+	tree, err := checker.Expand(context.Background(), "doc:readme", "viewer", 0)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	assertTree(t, tree, `{
+		"type": "union", "object": "doc:readme", "relation": "viewer",
+		"children": [
+			{"type": "this", "subjects": ["user:carol"]},
+			{"type": "computed_userset", "relation": "editor", "children": [
+				{"type": "union", "object": "doc:readme", "relation": "editor", "children": [
+					{"type": "this", "children": [
+						{"type": "this", "object": "group:eng", "relation": "member", "subjects": ["user:bob"]}
+					]},
+					{"type": "computed_userset", "relation": "owner", "children": [
+						{"type": "this", "object": "doc:readme", "relation": "owner", "subjects": ["user:alice"]}
+					]}
+				]}
+			]}
+		]
+	}`)
+}
+
+func TestExpandTupleToUsersetAndSetOperations(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{
+		{
+			Namespace: "doc",
+			Relations: map[string]consul.RelationConfig{
+				"parent": {},
+				"banned": {},
+				"viewer": {
+					Exclusion: &consul.ExclusionConfig{
+						Base: consul.UnionConfig{TupleToUserset: &consul.TupleToUsersetConfig{
+							Tupleset:        consul.TuplesetConfig{Relation: "parent"},
+							ComputedUserset: consul.ComputedUsersetConfig{Relation: "viewer"},
+						}},
+						Subtract: consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "banned"}},
+					},
+				},
+			},
+		},
+	}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "parent", User: "folder:eng"},
+		{Object: "doc:readme", Relation: "banned", User: "user:mallory"},
+		{Object: "folder:eng", Relation: "viewer", User: "user:bob"},
+	})
+
+	tree, err := checker.Expand(context.Background(), "doc:readme", "viewer", 0)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	assertTree(t, tree, `{
+		"type": "exclusion", "object": "doc:readme", "relation": "viewer",
+		"children": [
+			{"type": "tuple_to_userset", "relation": "viewer", "tupleset": "parent", "children": [
+				{"type": "this", "object": "folder:eng", "relation": "viewer", "subjects": ["user:bob"]}
+			]},
+			{"type": "computed_userset", "relation": "banned", "children": [
+				{"type": "this", "object": "doc:readme", "relation": "banned", "subjects": ["user:mallory"]}
+			]}
+		]
+	}`)
+}
+
+func TestExpandLimitsAndCycles(t *testing.T) {
+	checker := newTestChecker(t, nil, []leveldb.ACLTuple{
+		{Object: "group:a", Relation: "member", User: "group:b#member"},
+		{Object: "group:b", Relation: "member", User: "group:a#member"},
+		{Object: "group:b", Relation: "member", User: "user:bob"},
+	})
+
+	tree, err := checker.Expand(context.Background(), "group:a", "member", 0)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	assertTree(t, tree, `{
+		"type": "this", "object": "group:a", "relation": "member", "children": [
+			{"type": "this", "object": "group:b", "relation": "member", "subjects": ["user:bob"], "children": [
+				{"type": "userset", "object": "group:a", "relation": "member", "cycle": true}
+			]}
+		]
+	}`)
+
+	tree, err = checker.Expand(context.Background(), "group:a", "member", 1)
+	if err != nil {
+		t.Fatalf("Expand with depth 1: %v", err)
+	}
+	assertTree(t, tree, `{
+		"type": "this", "object": "group:a", "relation": "member", "children": [
+			{"type": "userset", "object": "group:b", "relation": "member", "truncated": true}
+		]
+	}`)
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestComputedUsersetGolden evaluates every object#relation@user combination
+// of the doc example from the project brief and compares the decisions with
+// testdata/doc.golden. Run with -update after an intentional change.
+func TestComputedUsersetGolden(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+		{Object: "doc:readme", Relation: "editor", User: "user:bob"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+		{Object: "doc:report", Relation: "editor", User: "user:carol"},
+		{Object: "doc:report", Relation: "viewer", User: "user:dave"},
+
+		// A tuple whose object is a user. computed_userset must evaluate
+		// doc:readme#owner@user, never user:alice#owner@user, so this tuple
+		// must not make mallory an editor or viewer of doc:readme.
+		{Object: "user:alice", Relation: "owner", User: "user:mallory"},
+	})
+
+	objects := []string{"doc:readme", "doc:report"}
+	relations := []string{"owner", "editor", "viewer"}
+	users := []string{"user:alice", "user:bob", "user:carol", "user:dave", "user:mallory"}
+
+	var b strings.Builder
+	for _, object := range objects {
+		for _, relation := range relations {
+			for _, user := range users {
+				authorized, err := checker.Check(context.Background(), object, relation, user)
+				if err != nil {
+					t.Fatalf("Check(%s#%s@%s): %v", object, relation, user, err)
+				}
+				fmt.Fprintf(&b, "%s#%s@%s %v\n", object, relation, user, authorized)
+			}
+		}
+	}
+
+	golden := filepath.Join("testdata", "doc.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(b.String()), 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+
+	gotLines := strings.Split(b.String(), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	if len(gotLines) != len(wantLines) {
+		t.Fatalf("got %d decisions, golden has %d", len(gotLines), len(wantLines))
+	}
+	for i := range gotLines {
+		if gotLines[i] != wantLines[i] {
+			t.Errorf("decision %d = %q, golden %q", i+1, gotLines[i], wantLines[i])
+		}
+	}
+}
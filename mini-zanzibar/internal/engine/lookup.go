@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LookupResources returns the IDs of the objects in namespace that subject
+// has relation to, in ascending order. Only IDs greater than after are
+// returned, at most limit of them; more is true if another object after the
+// last returned ID was confirmed, in which case that ID is the cursor of the
+// next page.
+//
+// Candidates are found by walking the reverse index from the subject: every
+// object it holds a tuple on, every userset it is a member of, and every
+// object referencing those usersets or objects. The walk has to visit the
+// objects before the cursor too, since they may lead to objects after it,
+// but it only keeps candidates after the cursor. Those are confirmed with
+// Check in ascending order, sharing their intermediate results, and
+// confirmation stops at the first object past the page.
+func (c *Checker) LookupResources(ctx context.Context, namespace, relation, subject, after string, limit int) (ids []string, more bool, err error) {
+	candidates, err := c.reachableObjects(ctx, namespace, subject, after)
+	if err != nil {
+		return nil, false, err
+	}
+
+	opts := CheckOptions{Memo: NewMemo()}
+	for candidates.Len() > 0 {
+		candidate := heap.Pop(candidates).(string)
+
+		authorized, err := c.CheckWithOptions(ctx, namespace+":"+candidate, relation, subject, opts)
+		if err != nil {
+			return nil, false, err
+		}
+		if !authorized {
+			continue
+		}
+		if limit > 0 && len(ids) == limit {
+			return ids, true, nil
+		}
+		ids = append(ids, candidate)
+	}
+
+	return ids, false, nil
+}
+
+// reachableObjects returns the IDs greater than after of the objects in
+// namespace that are connected to subject through stored tuples, as a heap
+// so they can be taken in order without sorting those never confirmed
+func (c *Checker) reachableObjects(ctx context.Context, namespace, subject, after string) (*idHeap, error) {
+	prefix := namespace + ":"
+	objects := make(map[string]bool)
+	visited := map[string]bool{subject: true}
+	queue := []string{subject}
+
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		current := queue[0]
+		queue = queue[1:]
+
+		tuples, err := c.tuples.ListTuplesByUser(current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tuples by user: %v", err)
+		}
+
+		for _, tuple := range tuples {
+			if id, ok := strings.CutPrefix(tuple.Object, prefix); ok && id > after {
+				objects[id] = true
+			}
+
+			// Tuples naming the userset reach the subject through userset
+			// subjects; tuples naming the object itself through
+			// tuple_to_userset
+			for _, next := range []string{tuple.Object + "#" + tuple.Relation, tuple.Object} {
+				if !visited[next] {
+					visited[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+
+	ids := make(idHeap, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	heap.Init(&ids)
+	return &ids, nil
+}
+
+// idHeap is a min-heap of object IDs
+type idHeap []string
+
+func (h idHeap) Len() int           { return len(h) }
+func (h idHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h idHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *idHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+
+func (h *idHeap) Pop() interface{} {
+	old := *h
+	id := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return id
+}
+
+// Subject is a subject returned by LookupSubjects. Path lists the
+// object#relation checks through which the confirming check granted the
+// relation, from the looked up relation to the one holding the tuple that
+// names the subject.
+type Subject struct {
+	Subject string   `json:"subject"`
+	Path    []string `json:"path"`
+}
+
+// LookupSubjects returns the concrete subjects that have relation to object,
+// sorted by subject. Candidates are the subjects of the expanded userset
+// tree and each is confirmed with an explained check, so intersections and
+// exclusions apply and the path is taken from the confirmation. It returns
+// ErrMaxDepthExceeded if the tree is deeper than the maximum depth, since
+// subjects below that depth would be missing.
+func (c *Checker) LookupSubjects(ctx context.Context, object, relation string) ([]Subject, error) {
+	tree, err := c.Expand(ctx, object, relation, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]bool)
+	if truncated := collectSubjects(tree, candidates); truncated {
+		return nil, ErrMaxDepthExceeded
+	}
+
+	subjects := make([]Subject, 0, len(candidates))
+	for subject := range candidates {
+		authorized, trace, err := c.Explain(ctx, object, relation, subject, CheckOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if authorized {
+			subjects = append(subjects, Subject{Subject: subject, Path: grantingPath(trace)})
+		}
+	}
+
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].Subject < subjects[j].Subject
+	})
+	return subjects, nil
+}
+
+// collectSubjects records every subject of node into subjects. Subtracted
+// branches of exclusions cannot grant anything and are skipped. It reports
+// whether any part of the tree was truncated.
+func collectSubjects(node *ExpandNode, subjects map[string]bool) (truncated bool) {
+	if node.Type == NodeUserset {
+		return node.Truncated
+	}
+
+	for _, subject := range node.Subjects {
+		subjects[subject] = true
+	}
+
+	children := node.Children
+	if node.Type == NodeExclusion && len(children) > 0 {
+		children = children[:1]
+	}
+	for _, child := range children {
+		if collectSubjects(child, subjects) {
+			truncated = true
+		}
+	}
+	return truncated
+}
+
+// grantingPath follows the steps of a granted check's trace that granted it,
+// i.e. the first granting branch of unions and intersections and the base of
+// exclusions, and returns the object#relation of every check step on the way
+func grantingPath(node *TraceNode) []string {
+	var path []string
+	for node != nil && node.Result {
+		if node.Type == TraceCheck {
+			path = append(path, node.Object+"#"+node.Relation)
+		}
+
+		var next *TraceNode
+		for _, child := range node.Children {
+			// Tuple lookups record what the store returned; they are no
+			// steps of the evaluation
+			if child.Result && child.Type != TraceTupleLookup {
+				next = child
+				break
+			}
+		}
+		node = next
+	}
+	return path
+}
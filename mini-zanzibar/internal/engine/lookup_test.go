@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+func TestLookupResources(t *testing.T) {
+	folderNamespace := consul.NamespaceConfig{
+		Namespace: "doc",
+		Relations: map[string]consul.RelationConfig{
+			"owner":  {},
+			"parent": {},
+			"banned": {},
+			"viewer": {
+				Union: []consul.UnionConfig{
+					{This: &consul.ThisConfig{}},
+					{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "owner"}},
+					{TupleToUserset: &consul.TupleToUsersetConfig{
+						Tupleset:        consul.TuplesetConfig{Relation: "parent"},
+						ComputedUserset: consul.ComputedUsersetConfig{Relation: "viewer"},
+					}},
+				},
+			},
+			"can_view": {
+				Exclusion: &consul.ExclusionConfig{
+					Base:     consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "viewer"}},
+					Subtract: consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "banned"}},
+				},
+			},
+		},
+	}
+
+	checker := newTestChecker(t, []consul.NamespaceConfig{folderNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:a", Relation: "owner", User: "user:bob"},
+		{Object: "doc:b", Relation: "viewer", User: "group:eng#member"},
+		{Object: "group:eng", Relation: "member", User: "user:bob"},
+		{Object: "doc:c", Relation: "parent", User: "folder:eng"},
+		{Object: "folder:eng", Relation: "viewer", User: "user:bob"},
+		{Object: "doc:d", Relation: "viewer", User: "user:bob"},
+		{Object: "doc:d", Relation: "banned", User: "user:bob"},
+		{Object: "doc:e", Relation: "parent", User: "user:bob"},
+		{Object: "doc:f", Relation: "viewer", User: "user:carol"},
+	})
+
+	lookup := func(relation, after string, limit int) ([]string, bool) {
+		t.Helper()
+		ids, more, err := checker.LookupResources(context.Background(), "doc", relation, "user:bob", after, limit)
+		if err != nil {
+			t.Fatalf("LookupResources(%s, %q, %d): %v", relation, after, limit, err)
+		}
+		return ids, more
+	}
+
+	if ids, more := lookup("viewer", "", 0); !reflect.DeepEqual(ids, []string{"a", "b", "c", "d"}) || more {
+		t.Errorf("viewer = %v, more %v; want [a b c d], false", ids, more)
+	}
+	if ids, _ := lookup("can_view", "", 0); !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Errorf("can_view = %v, want [a b c]", ids)
+	}
+	if ids, _ := lookup("owner", "", 0); !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("owner = %v, want [a]", ids)
+	}
+
+	// Paging resumes after the last returned ID
+	ids, more := lookup("viewer", "", 2)
+	if !reflect.DeepEqual(ids, []string{"a", "b"}) || !more {
+		t.Fatalf("first page = %v, more %v; want [a b], true", ids, more)
+	}
+	// e follows d but is no viewer, so the page is the last one
+	ids, more = lookup("viewer", "b", 2)
+	if !reflect.DeepEqual(ids, []string{"c", "d"}) || more {
+		t.Fatalf("second page = %v, more %v; want [c d], false", ids, more)
+	}
+	ids, more = lookup("viewer", "d", 2)
+	if len(ids) != 0 || more {
+		t.Fatalf("past the last page = %v, more %v; want [], false", ids, more)
+	}
+}
+
+func TestLookupSubjects(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{
+		docNamespace,
+		{
+			Namespace: "folder",
+			Relations: map[string]consul.RelationConfig{
+				"viewer":    {},
+				"banned":    {},
+				"commenter": {},
+				"can_view": {
+					Exclusion: &consul.ExclusionConfig{
+						Base:     consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "viewer"}},
+						Subtract: consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "banned"}},
+					},
+				},
+				"can_comment": {
+					Union: []consul.UnionConfig{
+						{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "can_view"}},
+						{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "commenter"}},
+					},
+				},
+			},
+		},
+	}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+		{Object: "doc:readme", Relation: "editor", User: "group:eng#member"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:alice"},
+		{Object: "group:eng", Relation: "member", User: "user:bob"},
+		{Object: "folder:eng", Relation: "viewer", User: "user:bob"},
+		{Object: "folder:eng", Relation: "viewer", User: "user:mallory"},
+		{Object: "folder:eng", Relation: "banned", User: "user:mallory"},
+		{Object: "folder:eng", Relation: "commenter", User: "user:mallory"},
+	})
+
+	subjects, err := checker.LookupSubjects(context.Background(), "doc:readme", "viewer")
+	if err != nil {
+		t.Fatalf("LookupSubjects: %v", err)
+	}
+	want := []Subject{
+		{Subject: "user:alice", Path: []string{"doc:readme#viewer"}},
+		{Subject: "user:bob", Path: []string{"doc:readme#viewer", "doc:readme#editor", "group:eng#member"}},
+		{Subject: "user:carol", Path: []string{"doc:readme#viewer"}},
+	}
+	if !reflect.DeepEqual(subjects, want) {
+		t.Errorf("LookupSubjects(doc:readme#viewer) = %+v, want %+v", subjects, want)
+	}
+
+	subjects, err = checker.LookupSubjects(context.Background(), "folder:eng", "can_view")
+	if err != nil {
+		t.Fatalf("LookupSubjects: %v", err)
+	}
+	want = []Subject{
+		{Subject: "user:bob", Path: []string{"folder:eng#can_view", "folder:eng#viewer"}},
+	}
+	if !reflect.DeepEqual(subjects, want) {
+		t.Errorf("LookupSubjects(folder:eng#can_view) = %+v, want %+v", subjects, want)
+	}
+
+	// Mallory is reached through can_view first, but only commenter grants
+	subjects, err = checker.LookupSubjects(context.Background(), "folder:eng", "can_comment")
+	if err != nil {
+		t.Fatalf("LookupSubjects: %v", err)
+	}
+	want = []Subject{
+		{Subject: "user:bob", Path: []string{"folder:eng#can_comment", "folder:eng#can_view", "folder:eng#viewer"}},
+		{Subject: "user:mallory", Path: []string{"folder:eng#can_comment", "folder:eng#commenter"}},
+	}
+	if !reflect.DeepEqual(subjects, want) {
+		t.Errorf("LookupSubjects(folder:eng#can_comment) = %+v, want %+v", subjects, want)
+	}
+}
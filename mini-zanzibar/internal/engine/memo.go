@@ -0,0 +1,43 @@
+package engine
+
+import "sync"
+
+// Memo records the results of object#relation@subject steps so checks
+// sharing it, possibly concurrently, evaluate each step only once. A Memo
+// must only be shared by checks that read the same tuples, and should not
+// outlive the request it was created for. The zero value is not usable;
+// create one with NewMemo. A nil *Memo memoizes nothing.
+type Memo struct {
+	mu      sync.RWMutex
+	results map[string]bool
+}
+
+// NewMemo creates an empty Memo
+func NewMemo() *Memo {
+	return &Memo{
+		results: make(map[string]bool),
+	}
+}
+
+func (m *Memo) get(node string) (authorized, ok bool) {
+	if m == nil {
+		return false, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	authorized, ok = m.results[node]
+	return authorized, ok
+}
+
+func (m *Memo) set(node string, authorized bool) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.results[node] = authorized
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+func TestMemoSharesResults(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+	})
+	recorder := &lookupRecorder{TupleReader: checker.tuples, relations: make(map[string]int)}
+	checker.tuples = recorder
+
+	memo := NewMemo()
+	opts := CheckOptions{Memo: memo}
+
+	if ok, err := checker.CheckWithOptions(context.Background(), "doc:readme", "editor", "user:alice", opts); err != nil || !ok {
+		t.Fatalf("CheckWithOptions(editor) = %v, %v, want true", ok, err)
+	}
+	lookups := recorder.relations["owner"]
+
+	// viewer reaches editor, which is already known
+	if ok, err := checker.CheckWithOptions(context.Background(), "doc:readme", "viewer", "user:alice", opts); err != nil || !ok {
+		t.Fatalf("CheckWithOptions(viewer) = %v, %v, want true", ok, err)
+	}
+	if recorder.relations["owner"] != lookups || recorder.relations["editor"] != 1 {
+		t.Errorf("lookups = %v, want editor and owner read once", recorder.relations)
+	}
+}
+
+func TestMemoSkipsResultsOfCutCycles(t *testing.T) {
+	computed := func(relation string) consul.UnionConfig {
+		return consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: relation}}
+	}
+
+	// first reaches second, which only reaches first again, before reading
+	// its own tuples. While first is on the path, second evaluates to false.
+	checker := newTestChecker(t, []consul.NamespaceConfig{
+		{
+			Namespace: "loop",
+			Relations: map[string]consul.RelationConfig{
+				"first":  {Union: []consul.UnionConfig{computed("second"), {This: &consul.ThisConfig{}}}},
+				"second": {Union: []consul.UnionConfig{computed("first")}},
+			},
+		},
+	}, []leveldb.ACLTuple{
+		{Object: "loop:a", Relation: "first", User: "user:alice"},
+	})
+
+	opts := CheckOptions{Memo: NewMemo()}
+	for _, relation := range []string{"first", "second"} {
+		ok, err := checker.CheckWithOptions(context.Background(), "loop:a", relation, "user:alice", opts)
+		if err != nil || !ok {
+			t.Errorf("CheckWithOptions(%s) = %v, %v, want true", relation, ok, err)
+		}
+	}
+}
+
+func TestMemoSkipsCutCyclesUnderExclusion(t *testing.T) {
+	computed := func(relation string) consul.UnionConfig {
+		return consul.UnionConfig{ComputedUserset: &consul.ComputedUsersetConfig{Relation: relation}}
+	}
+
+	// gate = member AND NOT blocked, blocked = gate OR this. While blocked
+	// is on the path, the cut turns the subtracted branch false and gate
+	// true, which must not be reused once blocked is evaluated in full.
+	checker := newTestChecker(t, []consul.NamespaceConfig{
+		{
+			Namespace: "loop",
+			Relations: map[string]consul.RelationConfig{
+				"member": {},
+				"gate": {Exclusion: &consul.ExclusionConfig{
+					Base:     computed("member"),
+					Subtract: computed("blocked"),
+				}},
+				"blocked": {Union: []consul.UnionConfig{computed("gate"), {This: &consul.ThisConfig{}}}},
+			},
+		},
+	}, []leveldb.ACLTuple{
+		{Object: "loop:a", Relation: "member", User: "user:alice"},
+		{Object: "loop:a", Relation: "blocked", User: "user:alice"},
+	})
+
+	opts := CheckOptions{Memo: NewMemo()}
+	for _, tc := range []struct {
+		relation string
+		want     bool
+	}{
+		{"blocked", true},
+		{"gate", false},
+	} {
+		ok, err := checker.CheckWithOptions(context.Background(), "loop:a", tc.relation, "user:alice", opts)
+		if err != nil || ok != tc.want {
+			t.Errorf("CheckWithOptions(%s) = %v, %v, want %v", tc.relation, ok, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package engine
+
+import "mini-zanzibar/internal/database/leveldb"
+
+// Step types of an explained check
+const (
+	TraceCheck           = "check"
+	TraceThis            = "this"
+	TraceComputedUserset = "computed_userset"
+	TraceTupleToUserset  = "tuple_to_userset"
+	TraceUnion           = "union"
+	TraceIntersection    = "intersection"
+	TraceExclusion       = "exclusion"
+	TraceTupleLookup     = "tuple_lookup"
+	// TraceCache is not produced by the engine; callers that answer checks
+	// from a cache wrap the trace in it to record a hit or miss
+	TraceCache = "cache"
+)
+
+// TraceNode is a step of an explained check. Check steps name the
+// object#relation@subject being evaluated, rewrite steps mirror the
+// namespace configuration and tuple lookups record what the store returned.
+type TraceNode struct {
+	Type     string `json:"type"`
+	Object   string `json:"object,omitempty"`
+	Relation string `json:"relation,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+	Tupleset string `json:"tupleset,omitempty"`
+	// Found lists the users of the tuples returned by a listing lookup
+	Found    []string `json:"found,omitempty"`
+	Result   bool     `json:"result"`
+	Reason   string   `json:"reason,omitempty"`
+	Memoized bool     `json:"memoized,omitempty"`
+	Error    string   `json:"error,omitempty"`
+
+	Children []*TraceNode `json:"children,omitempty"`
+}
+
+// begin adds node to the trace and makes it the current step. It returns
+// nil when the check is not explained; the other trace methods accept nil.
+func (r *request) begin(node *TraceNode) *TraceNode {
+	if r.trace == nil {
+		return nil
+	}
+
+	r.trace.Children = append(r.trace.Children, node)
+	parent := r.trace
+	r.trace = node
+	r.parents = append(r.parents, parent)
+	return node
+}
+
+// end finishes step with its result and returns the result
+func (r *request) end(step *TraceNode, result bool, reason string) bool {
+	if step == nil {
+		return result
+	}
+
+	step.Result = result
+	step.Reason = reason
+	r.trace = r.parents[len(r.parents)-1]
+	r.parents = r.parents[:len(r.parents)-1]
+	return result
+}
+
+// fail finishes step with err and returns err
+func (r *request) fail(step *TraceNode, err error) error {
+	if step != nil {
+		step.Error = err.Error()
+		r.end(step, false, "")
+	}
+	return err
+}
+
+// lookupTuple records a direct tuple lookup in the current step
+func (r *request) lookupTuple(object, relation, subject string, found bool) {
+	if r.trace == nil {
+		return
+	}
+
+	r.trace.Children = append(r.trace.Children, &TraceNode{
+		Type:     TraceTupleLookup,
+		Object:   object,
+		Relation: relation,
+		Subject:  subject,
+		Result:   found,
+	})
+}
+
+// lookup records a tuple listing in the current step
+func (r *request) lookup(object, relation string, tuples []leveldb.ACLTuple) {
+	if r.trace == nil {
+		return
+	}
+
+	node := &TraceNode{
+		Type:     TraceTupleLookup,
+		Object:   object,
+		Relation: relation,
+		Result:   len(tuples) > 0,
+	}
+	for _, tuple := range tuples {
+		node.Found = append(node.Found, tuple.User)
+	}
+	r.trace.Children = append(r.trace.Children, node)
+}
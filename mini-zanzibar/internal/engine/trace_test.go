@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"mini-zanzibar/internal/database/consul"
+	"mini-zanzibar/internal/database/leveldb"
+)
+
+func TestExplain(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{
+		{
+			Namespace: "doc",
+			Relations: map[string]consul.RelationConfig{
+				"owner": {},
+				"viewer": {
+					Union: []consul.UnionConfig{
+						{This: &consul.ThisConfig{}},
+						{ComputedUserset: &consul.ComputedUsersetConfig{Relation: "owner"}},
+					},
+				},
+			},
+		},
+	}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+		{Object: "doc:readme", Relation: "viewer", User: "user:carol"},
+	})
+
+	for _, tc := range []struct {
+		name    string
+		subject string
+		want    bool
+		trace   string
+	}{
+		{
+			name:    "granted through rewrite",
+			subject: "user:alice",
+			want:    true,
+			trace: `{"type": "check", "object": "doc:readme", "relation": "viewer", "subject": "user:alice", "result": true, "children": [
+				{"type": "union", "result": true, "reason": "child 1 granted", "children": [
+					{"type": "this", "result": false, "reason": "no direct tuple or userset granted", "children": [
+						{"type": "tuple_lookup", "object": "doc:readme", "relation": "viewer", "subject": "user:alice", "result": false},
+						{"type": "tuple_lookup", "object": "doc:readme", "relation": "viewer", "found": ["user:carol"], "result": true}
+					]},
+					{"type": "computed_userset", "relation": "owner", "result": true, "children": [
+						{"type": "check", "object": "doc:readme", "relation": "owner", "subject": "user:alice", "result": true, "children": [
+							{"type": "this", "result": true, "reason": "direct tuple found", "children": [
+								{"type": "tuple_lookup", "object": "doc:readme", "relation": "owner", "subject": "user:alice", "result": true}
+							]}
+						]}
+					]}
+				]}
+			]}`,
+		},
+		{
+			name:    "denied",
+			subject: "user:dave",
+			want:    false,
+			trace: `{"type": "check", "object": "doc:readme", "relation": "viewer", "subject": "user:dave", "result": false, "children": [
+				{"type": "union", "result": false, "reason": "no child granted", "children": [
+					{"type": "this", "result": false, "reason": "no direct tuple or userset granted", "children": [
+						{"type": "tuple_lookup", "object": "doc:readme", "relation": "viewer", "subject": "user:dave", "result": false},
+						{"type": "tuple_lookup", "object": "doc:readme", "relation": "viewer", "found": ["user:carol"], "result": true}
+					]},
+					{"type": "computed_userset", "relation": "owner", "result": false, "children": [
+						{"type": "check", "object": "doc:readme", "relation": "owner", "subject": "user:dave", "result": false, "children": [
+							{"type": "this", "result": false, "reason": "no direct tuple or userset granted", "children": [
+								{"type": "tuple_lookup", "object": "doc:readme", "relation": "owner", "subject": "user:dave", "result": false},
+								{"type": "tuple_lookup", "object": "doc:readme", "relation": "owner", "found": ["user:alice"], "result": true}
+							]}
+						]}
+					]}
+				]}
+			]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			authorized, trace, err := checker.Explain(context.Background(), "doc:readme", "viewer", tc.subject, CheckOptions{})
+			if err != nil {
+				t.Fatalf("Explain: %v", err)
+			}
+			if authorized != tc.want {
+				t.Errorf("Explain = %v, want %v", authorized, tc.want)
+			}
+
+			got, _ := json.Marshal(trace)
+			var want TraceNode
+			if err := json.Unmarshal([]byte(tc.trace), &want); err != nil {
+				t.Fatalf("unmarshal want: %v", err)
+			}
+			wantJSON, _ := json.Marshal(&want)
+			if string(got) != string(wantJSON) {
+				t.Errorf("trace =\n%s\nwant\n%s", got, wantJSON)
+			}
+		})
+	}
+}
+
+func TestExplainRecordsErrorsAndMemoHits(t *testing.T) {
+	checker := newTestChecker(t, []consul.NamespaceConfig{docNamespace}, []leveldb.ACLTuple{
+		{Object: "doc:readme", Relation: "owner", User: "user:alice"},
+	})
+
+	opts := CheckOptions{Memo: NewMemo()}
+	if _, err := checker.CheckWithOptions(context.Background(), "doc:readme", "viewer", "user:alice", opts); err != nil {
+		t.Fatalf("CheckWithOptions: %v", err)
+	}
+	authorized, trace, err := checker.Explain(context.Background(), "doc:readme", "viewer", "user:alice", opts)
+	if err != nil || !authorized {
+		t.Fatalf("Explain = %v, %v, want true", authorized, err)
+	}
+	if !trace.Memoized || trace.Reason != "memoized result" {
+		t.Errorf("trace = %+v, want memoized root", trace)
+	}
+
+	shallow := NewChecker(checker.tuples, checker.namespaces, 1)
+	_, trace, err = shallow.Explain(context.Background(), "doc:readme", "viewer", "user:alice", CheckOptions{})
+	if err == nil {
+		t.Fatalf("Explain with depth 1 succeeded, want ErrMaxDepthExceeded")
+	}
+	if trace.Error != ErrMaxDepthExceeded.Error() {
+		t.Errorf("trace error = %q, want %q", trace.Error, ErrMaxDepthExceeded)
+	}
+}
@@ -0,0 +1,17 @@
+package engine
+
+import "strings"
+
+// ParseUserset splits a userset subject in the format
+// namespace:object_id#relation, such as group:eng#member. ok is false for
+// plain subjects like user:alice.
+func ParseUserset(subject string) (object, relation string, ok bool) {
+	object, relation, found := strings.Cut(subject, "#")
+	if !found || relation == "" || strings.Contains(relation, "#") {
+		return "", "", false
+	}
+	if _, ok := namespaceOf(object); !ok {
+		return "", "", false
+	}
+	return object, relation, true
+}
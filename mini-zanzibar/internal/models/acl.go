@@ -19,9 +19,113 @@ type ACLCheckResponse struct {
 	Authorized bool `json:"authorized"`
 }
 
+// ContextualCheckRequest represents an authorization check sent in a request
+// body. Contextual tuples are evaluated as if stored, for this check only.
+type ContextualCheckRequest struct {
+	Object           string     `json:"object" binding:"required"`
+	Relation         string     `json:"relation" binding:"required"`
+	User             string     `json:"user" binding:"required"`
+	ContextualTuples []ACLTuple `json:"contextual_tuples"`
+}
+
+// BatchCheckRequest represents a request to check several authorizations at
+// once. Contextual tuples apply to every item.
+type BatchCheckRequest struct {
+	Items            []ACLCheckRequest `json:"items" binding:"required"`
+	ContextualTuples []ACLTuple        `json:"contextual_tuples"`
+}
+
+// BatchCheckResult represents the result of a single item of a batch check
+type BatchCheckResult struct {
+	Authorized bool   `json:"authorized"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BatchCheckResponse represents the response for a batch check, with one
+// result per item in request order
+type BatchCheckResponse struct {
+	Results []BatchCheckResult `json:"results"`
+}
+
+// ACLExpandRequest represents a request to expand the userset tree of an
+// object#relation
+type ACLExpandRequest struct {
+	Object   string `form:"object" binding:"required"`
+	Relation string `form:"relation" binding:"required"`
+	Depth    int    `form:"depth"`
+}
+
+// LookupResourcesRequest represents a request to list the objects of a
+// namespace a user has a relation to
+type LookupResourcesRequest struct {
+	Namespace string `form:"namespace" binding:"required"`
+	Relation  string `form:"relation" binding:"required"`
+	User      string `form:"user" binding:"required"`
+	Cursor    string `form:"cursor"`
+	PageSize  int    `form:"page_size"`
+}
+
+// LookupResourcesResponse represents a page of LookupResources results
+type LookupResourcesResponse struct {
+	ObjectIDs  []string `json:"object_ids"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// TupleQueryRequest filters the tuples listed by the tuple query endpoint
+type TupleQueryRequest struct {
+	Namespace      string `form:"namespace"`
+	ObjectID       string `form:"object_id"`
+	ObjectIDPrefix string `form:"object_id_prefix"`
+	Relation       string `form:"relation"`
+	SubjectType    string `form:"subject_type"`
+	SubjectID      string `form:"subject_id"`
+	Cursor         string `form:"cursor"`
+	PageSize       int    `form:"page_size"`
+}
+
+// LookupSubjectsRequest represents a request to list the subjects that have
+// a relation to an object
+type LookupSubjectsRequest struct {
+	Object   string `form:"object" binding:"required"`
+	Relation string `form:"relation" binding:"required"`
+}
+
 // ACLTuple represents an ACL tuple stored in the database
 type ACLTuple struct {
 	Object   string `json:"object"`
 	Relation string `json:"relation"`
 	User     string `json:"user"`
 }
+
+// TupleChange is a single tuple write reported by the watch API
+type TupleChange struct {
+	Operation string   `json:"operation"`
+	Tuple     ACLTuple `json:"tuple"`
+}
+
+// WatchEvent lists the tuple changes committed at one revision. Zookie is
+// the revision's token and the cursor to resume watching after it.
+type WatchEvent struct {
+	Zookie  string        `json:"zookie"`
+	Changes []TupleChange `json:"changes"`
+}
+
+// WatchResponse is the response of a long-poll watch request
+type WatchResponse struct {
+	Events     []WatchEvent `json:"events"`
+	NextCursor string       `json:"next_cursor"`
+}
+
+// WriteRequest applies several tuple updates atomically. Operations are
+// touch, create and delete; preconditions are must_exist or must_not_exist.
+type WriteRequest struct {
+	Updates       []TupleChange       `json:"updates"`
+	Preconditions []WritePrecondition `json:"preconditions"`
+}
+
+// WritePrecondition is a condition on a tuple that must hold for a write to
+// be applied
+type WritePrecondition struct {
+	Condition string   `json:"condition"`
+	Tuple     ACLTuple `json:"tuple"`
+}
@@ -13,15 +13,29 @@ type NamespaceConfig struct {
 	Version   int                       `json:"version"`
 }
 
-// RelationConfig represents the configuration for a specific relation
+// RelationConfig represents the configuration for a specific relation.
+// At most one of the set operations is used as the relation's rewrite.
 type RelationConfig struct {
-	Union []UnionConfig `json:"union,omitempty"`
+	Union        []UnionConfig    `json:"union,omitempty"`
+	Intersection []UnionConfig    `json:"intersection,omitempty"`
+	Exclusion    *ExclusionConfig `json:"exclusion,omitempty"`
 }
 
-// UnionConfig represents a union operation in relation configuration
+// UnionConfig represents a single rewrite node. It is either a leaf (this,
+// computed_userset, tuple_to_userset) or a nested set operation.
 type UnionConfig struct {
 	This            *ThisConfig            `json:"this,omitempty"`
 	ComputedUserset *ComputedUsersetConfig `json:"computed_userset,omitempty"`
+	TupleToUserset  *TupleToUsersetConfig  `json:"tuple_to_userset,omitempty"`
+	Union           []UnionConfig          `json:"union,omitempty"`
+	Intersection    []UnionConfig          `json:"intersection,omitempty"`
+	Exclusion       *ExclusionConfig       `json:"exclusion,omitempty"`
+}
+
+// ExclusionConfig represents the users of base that are not in subtract
+type ExclusionConfig struct {
+	Base     UnionConfig `json:"base"`
+	Subtract UnionConfig `json:"subtract"`
 }
 
 // ThisConfig represents a direct relation
@@ -32,6 +46,18 @@ type ComputedUsersetConfig struct {
 	Relation string `json:"relation"`
 }
 
+// TupleToUsersetConfig represents a userset computed on the objects that the
+// tupleset relation points to, e.g. the viewers of a document's parent folder
+type TupleToUsersetConfig struct {
+	Tupleset        TuplesetConfig        `json:"tupleset"`
+	ComputedUserset ComputedUsersetConfig `json:"computed_userset"`
+}
+
+// TuplesetConfig names the relation whose tuples reference other objects
+type TuplesetConfig struct {
+	Relation string `json:"relation"`
+}
+
 // NamespaceResponse represents the response when retrieving a namespace
 type NamespaceResponse struct {
 	Namespace string                    `json:"namespace"`
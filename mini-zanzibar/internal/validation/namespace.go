@@ -0,0 +1,259 @@
+// Package validation checks namespace configurations before they are stored
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mini-zanzibar/internal/models"
+	"mini-zanzibar/pkg/errors"
+)
+
+// identifierPattern is the format of namespace and relation names
+var identifierPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+
+// FieldError describes a single invalid field of a namespace configuration
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidateNamespace checks a namespace configuration and returns a
+// validation error listing every invalid field, or nil if it is valid
+func ValidateNamespace(req models.NamespaceRequest) *errors.CustomError {
+	v := &validator{relations: req.Relations}
+
+	if !identifierPattern.MatchString(req.Namespace) {
+		v.addf("namespace", "invalid identifier %q: must start with a letter and contain only letters, digits, '_' or '-'", req.Namespace)
+	}
+
+	if len(req.Relations) == 0 {
+		v.addf("relations", "at least one relation is required")
+	}
+
+	for _, name := range sortedRelationNames(req.Relations) {
+		field := "relations." + name
+		if !identifierPattern.MatchString(name) {
+			v.addf(field, "invalid identifier %q: must start with a letter and contain only letters, digits, '_' or '-'", name)
+		}
+		v.validateRelation(field, req.Relations[name])
+	}
+
+	v.validateCycles()
+
+	if len(v.errors) == 0 {
+		return nil
+	}
+
+	return errors.NewValidationError("invalid namespace configuration", map[string]interface{}{
+		"errors": v.errors,
+	})
+}
+
+type validator struct {
+	relations map[string]models.RelationConfig
+	errors    []FieldError
+}
+
+func (v *validator) addf(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateRelation checks the rewrite of a single relation. A relation uses
+// at most one set operation; a relation with none is granted directly.
+func (v *validator) validateRelation(field string, config models.RelationConfig) {
+	operations := 0
+	if config.Union != nil {
+		operations++
+		v.validateChildren(field+".union", config.Union)
+	}
+	if config.Intersection != nil {
+		operations++
+		v.validateChildren(field+".intersection", config.Intersection)
+	}
+	if config.Exclusion != nil {
+		operations++
+		v.validateExclusion(field+".exclusion", config.Exclusion)
+	}
+
+	if operations > 1 {
+		v.addf(field, "only one of union, intersection or exclusion may be set")
+	}
+}
+
+// validateChildren checks the children of a union or intersection
+func (v *validator) validateChildren(field string, children []models.UnionConfig) {
+	if len(children) == 0 {
+		v.addf(field, "must contain at least one child")
+		return
+	}
+
+	for i, child := range children {
+		childField := fmt.Sprintf("%s[%d]", field, i)
+		for j := 0; j < i; j++ {
+			if reflect.DeepEqual(children[j], child) {
+				v.addf(childField, "duplicate of %s[%d]", field, j)
+				break
+			}
+		}
+		v.validateNode(childField, child)
+	}
+}
+
+// validateExclusion checks the base and subtract of an exclusion
+func (v *validator) validateExclusion(field string, exclusion *models.ExclusionConfig) {
+	v.validateNode(field+".base", exclusion.Base)
+	v.validateNode(field+".subtract", exclusion.Subtract)
+}
+
+// validateNode checks that a rewrite node sets exactly one operation and
+// that every relation it references is valid
+func (v *validator) validateNode(field string, node models.UnionConfig) {
+	operations := 0
+
+	if node.This != nil {
+		operations++
+	}
+
+	if node.ComputedUserset != nil {
+		operations++
+		v.validateRelationRef(field+".computed_userset.relation", node.ComputedUserset.Relation)
+	}
+
+	if ttu := node.TupleToUserset; ttu != nil {
+		operations++
+		v.validateRelationRef(field+".tuple_to_userset.tupleset.relation", ttu.Tupleset.Relation)
+
+		// The computed relation lives on the referenced objects, which may be
+		// of another namespace, so only its format can be checked here
+		computedField := field + ".tuple_to_userset.computed_userset.relation"
+		if ttu.ComputedUserset.Relation == "" {
+			v.addf(computedField, "relation is required")
+		} else if !identifierPattern.MatchString(ttu.ComputedUserset.Relation) {
+			v.addf(computedField, "invalid identifier %q", ttu.ComputedUserset.Relation)
+		}
+	}
+
+	if node.Union != nil {
+		operations++
+		v.validateChildren(field+".union", node.Union)
+	}
+
+	if node.Intersection != nil {
+		operations++
+		v.validateChildren(field+".intersection", node.Intersection)
+	}
+
+	if node.Exclusion != nil {
+		operations++
+		v.validateExclusion(field+".exclusion", node.Exclusion)
+	}
+
+	switch {
+	case operations == 0:
+		v.addf(field, "empty rewrite node: one of this, computed_userset, tuple_to_userset, union, intersection or exclusion is required")
+	case operations > 1:
+		v.addf(field, "a rewrite node may only set one of this, computed_userset, tuple_to_userset, union, intersection or exclusion")
+	}
+}
+
+// validateRelationRef checks a reference to a relation of this namespace
+func (v *validator) validateRelationRef(field, relation string) {
+	if relation == "" {
+		v.addf(field, "relation is required")
+		return
+	}
+	if _, exists := v.relations[relation]; !exists {
+		v.addf(field, "relation %q is not defined in this namespace", relation)
+	}
+}
+
+// validateCycles rejects relations whose computed_userset rewrites refer
+// back to themselves, e.g. editor -> viewer -> editor. Such a rewrite can
+// never be resolved on a single object. tuple_to_userset is not an edge
+// because it moves to other objects.
+func (v *validator) validateCycles() {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := make(map[string]int)
+	var stack []string
+	reported := make(map[string]bool)
+
+	var visit func(relation string)
+	visit = func(relation string) {
+		state[relation] = visiting
+		stack = append(stack, relation)
+
+		for _, next := range computedReferences(v.relations[relation]) {
+			if _, exists := v.relations[next]; !exists {
+				continue // Reported as an undefined relation
+			}
+
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				start := 0
+				for stack[start] != next {
+					start++
+				}
+				cycle := append(append([]string{}, stack[start:]...), next)
+				if !reported[next] {
+					reported[next] = true
+					v.addf("relations."+next, "circular rewrite: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[relation] = done
+	}
+
+	for _, name := range sortedRelationNames(v.relations) {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+}
+
+// computedReferences returns the relations a relation's rewrite reaches on
+// the same object through computed_userset nodes
+func computedReferences(config models.RelationConfig) []string {
+	var refs []string
+
+	var walk func(node models.UnionConfig)
+	walk = func(node models.UnionConfig) {
+		if node.ComputedUserset != nil {
+			refs = append(refs, node.ComputedUserset.Relation)
+		}
+		for _, child := range node.Union {
+			walk(child)
+		}
+		for _, child := range node.Intersection {
+			walk(child)
+		}
+		if node.Exclusion != nil {
+			walk(node.Exclusion.Base)
+			walk(node.Exclusion.Subtract)
+		}
+	}
+
+	walk(models.UnionConfig{Union: config.Union, Intersection: config.Intersection, Exclusion: config.Exclusion})
+	return refs
+}
+
+func sortedRelationNames(relations map[string]models.RelationConfig) []string {
+	names := make([]string, 0, len(relations))
+	for name := range relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
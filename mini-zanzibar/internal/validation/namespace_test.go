@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"mini-zanzibar/internal/models"
+)
+
+func parseRequest(t *testing.T, body string) models.NamespaceRequest {
+	t.Helper()
+	var req models.NamespaceRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	return req
+}
+
+func TestValidateNamespaceAcceptsValidConfigs(t *testing.T) {
+	for name, body := range map[string]string{
+		"direct": `{"namespace": "doc", "relations": {"owner": {}}}`,
+		"computed userset": `{"namespace": "doc", "relations": {
+			"owner": {},
+			"editor": {"union": [{"this": {}}, {"computed_userset": {"relation": "owner"}}]},
+			"viewer": {"union": [{"this": {}}, {"computed_userset": {"relation": "editor"}}]}
+		}}`,
+		"tuple to userset": `{"namespace": "doc", "relations": {
+			"parent": {},
+			"viewer": {"union": [{"this": {}}, {"tuple_to_userset": {
+				"tupleset": {"relation": "parent"},
+				"computed_userset": {"relation": "viewer"}
+			}}]}
+		}}`,
+		"set operations": `{"namespace": "doc", "relations": {
+			"viewer": {}, "member": {}, "banned": {},
+			"can_view": {"exclusion": {
+				"base": {"intersection": [{"computed_userset": {"relation": "viewer"}}, {"computed_userset": {"relation": "member"}}]},
+				"subtract": {"computed_userset": {"relation": "banned"}}
+			}}
+		}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := ValidateNamespace(parseRequest(t, body)); err != nil {
+				t.Fatalf("ValidateNamespace = %v, details %v", err, err.Details)
+			}
+		})
+	}
+}
+
+func TestValidateNamespaceRejectsInvalidConfigs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		want []FieldError
+	}{
+		{
+			name: "invalid identifiers",
+			body: `{"namespace": "doc/../x", "relations": {"view er": {}}}`,
+			want: []FieldError{
+				{Field: "namespace"},
+				{Field: "relations.view er"},
+			},
+		},
+		{
+			name: "no relations",
+			body: `{"namespace": "doc", "relations": {}}`,
+			want: []FieldError{{Field: "relations"}},
+		},
+		{
+			name: "undefined relation",
+			body: `{"namespace": "doc", "relations": {
+				"viewer": {"union": [{"this": {}}, {"computed_userset": {"relation": "editor"}}]}
+			}}`,
+			want: []FieldError{{Field: "relations.viewer.union[1].computed_userset.relation"}},
+		},
+		{
+			name: "empty union",
+			body: `{"namespace": "doc", "relations": {"viewer": {"union": []}}}`,
+			want: []FieldError{{Field: "relations.viewer.union"}},
+		},
+		{
+			name: "empty and duplicate children",
+			body: `{"namespace": "doc", "relations": {
+				"viewer": {"union": [{"this": {}}, {}, {"this": {}}]}
+			}}`,
+			want: []FieldError{
+				{Field: "relations.viewer.union[1]"},
+				{Field: "relations.viewer.union[2]"},
+			},
+		},
+		{
+			name: "several operations in one node",
+			body: `{"namespace": "doc", "relations": {
+				"owner": {},
+				"viewer": {"union": [{"this": {}, "computed_userset": {"relation": "owner"}}]}
+			}}`,
+			want: []FieldError{{Field: "relations.viewer.union[0]"}},
+		},
+		{
+			name: "bad tupleset",
+			body: `{"namespace": "doc", "relations": {
+				"viewer": {"union": [{"tuple_to_userset": {
+					"tupleset": {"relation": "parent"},
+					"computed_userset": {"relation": ""}
+				}}]}
+			}}`,
+			want: []FieldError{
+				{Field: "relations.viewer.union[0].tuple_to_userset.tupleset.relation"},
+				{Field: "relations.viewer.union[0].tuple_to_userset.computed_userset.relation"},
+			},
+		},
+		{
+			name: "rewrite cycle",
+			body: `{"namespace": "doc", "relations": {
+				"editor": {"union": [{"this": {}}, {"computed_userset": {"relation": "viewer"}}]},
+				"viewer": {"union": [{"this": {}}, {"computed_userset": {"relation": "editor"}}]}
+			}}`,
+			want: []FieldError{{Field: "relations.editor", Message: "circular rewrite: editor -> viewer -> editor"}},
+		},
+		{
+			name: "self reference through exclusion",
+			body: `{"namespace": "doc", "relations": {
+				"viewer": {"exclusion": {
+					"base": {"this": {}},
+					"subtract": {"computed_userset": {"relation": "viewer"}}
+				}}
+			}}`,
+			want: []FieldError{{Field: "relations.viewer", Message: "circular rewrite: viewer -> viewer"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateNamespace(parseRequest(t, tc.body))
+			if err == nil {
+				t.Fatalf("ValidateNamespace = nil, want errors for %v", tc.want)
+			}
+
+			got, _ := err.Details["errors"].([]FieldError)
+			// Only compare messages where the case pins them down
+			for i := range got {
+				if i < len(tc.want) && tc.want[i].Message == "" {
+					got[i].Message = ""
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("errors = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
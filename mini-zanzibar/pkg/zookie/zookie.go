@@ -0,0 +1,39 @@
+// Package zookie encodes tuple store revisions as opaque consistency tokens.
+// A write returns the token of the revision it committed; passing it back as
+// at_least_as_fresh guarantees a read observes that write.
+package zookie
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prefix versions the token format
+const prefix = "zk1:"
+
+// Encode returns the token of a revision
+func Encode(revision uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(prefix + strconv.FormatUint(revision, 10)))
+}
+
+// Decode returns the revision of a token
+func Decode(token string) (uint64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid revision token")
+	}
+
+	value, found := strings.CutPrefix(string(data), prefix)
+	if !found {
+		return 0, fmt.Errorf("invalid revision token")
+	}
+
+	revision, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid revision token")
+	}
+
+	return revision, nil
+}
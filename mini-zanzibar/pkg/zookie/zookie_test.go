@@ -0,0 +1,23 @@
+package zookie
+
+import "testing"
+
+func TestRoundTrip(t *testing.T) {
+	for _, revision := range []uint64{0, 1, 42, 1<<64 - 1} {
+		got, err := Decode(Encode(revision))
+		if err != nil {
+			t.Fatalf("Decode(Encode(%d)): %v", revision, err)
+		}
+		if got != revision {
+			t.Errorf("Decode(Encode(%d)) = %d", revision, got)
+		}
+	}
+}
+
+func TestDecodeRejectsInvalidTokens(t *testing.T) {
+	for _, token := range []string{"", "not base64!", "MTI", Encode(1)[:4]} {
+		if _, err := Decode(token); err == nil {
+			t.Errorf("Decode(%q) succeeded, want error", token)
+		}
+	}
+}